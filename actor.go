@@ -0,0 +1,49 @@
+package main
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// normalizeActorKey lowercases name and collapses its whitespace, the form
+// ActorAliases are matched in
+func normalizeActorKey(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// canonicalActors renames the actors of info through aliases, matched
+// case-insensitively and ignoring extra whitespace. Actors that end up with
+// the same name are merged.
+func canonicalActors(info MovieInfo, aliases map[string]string) MovieInfo {
+	if len(aliases) == 0 || len(info.Actors) == 0 {
+		return info
+	}
+	lookup := make(map[string]string, len(aliases))
+	for alias, name := range aliases {
+		lookup[normalizeActorKey(alias)] = name
+	}
+
+	actors := make([]string, 0, len(info.Actors))
+	thumbs := make(map[string]string, len(info.ActorThumbs))
+	for _, actor := range info.Actors {
+		name := actor
+		if canonical, ok := lookup[normalizeActorKey(actor)]; ok && canonical != actor {
+			slog.Debug("Actor alias applied", "actor", actor, "to", canonical)
+			name = canonical
+		}
+		if slices.Contains(actors, name) {
+			continue
+		}
+		actors = append(actors, name)
+		if thumb, ok := info.ActorThumbs[actor]; ok {
+			thumbs[name] = thumb
+		}
+	}
+
+	info.Actors = actors
+	if info.ActorThumbs != nil {
+		info.ActorThumbs = thumbs
+	}
+	return info
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// metadataCache stores scraped MovieInfo in SQLite so re-runs don't fetch
+// the same codes again
+type metadataCache struct {
+	db *sql.DB
+	// ttl is how long an entry stays fresh, 0 means forever
+	ttl time.Duration
+}
+
+// openCache opens or creates the cache database at path
+func openCache(path string, ttl time.Duration) (*metadataCache, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening cache db: %v", err)
+	}
+	// SQLite allows one writer at a time, share a single connection
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS movies (
+		code       TEXT PRIMARY KEY,
+		info       TEXT NOT NULL,
+		fetched_at INTEGER NOT NULL
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating cache table: %v", err)
+	}
+	return &metadataCache{db: db, ttl: ttl}, nil
+}
+
+// get returns the cached info for code if there is a fresh entry
+func (c *metadataCache) get(code string) (MovieInfo, bool, error) {
+	var data string
+	var fetchedAt int64
+	err := c.db.QueryRow(`SELECT info, fetched_at FROM movies WHERE code = ?`, code).Scan(&data, &fetchedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return MovieInfo{}, false, nil
+	}
+	if err != nil {
+		return MovieInfo{}, false, fmt.Errorf("error reading cache: %v", err)
+	}
+	if c.ttl > 0 && time.Since(time.Unix(fetchedAt, 0)) > c.ttl {
+		return MovieInfo{}, false, nil
+	}
+
+	var info MovieInfo
+	if err := json.Unmarshal([]byte(data), &info); err != nil {
+		return MovieInfo{}, false, fmt.Errorf("error decoding cached info: %v", err)
+	}
+	return info, true, nil
+}
+
+// put stores info for code, replacing any older entry
+func (c *metadataCache) put(code string, info MovieInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("error encoding info: %v", err)
+	}
+	_, err = c.db.Exec(`INSERT OR REPLACE INTO movies (code, info, fetched_at) VALUES (?, ?, ?)`,
+		code, string(data), time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("error writing cache: %v", err)
+	}
+	return nil
+}
+
+// close closes the database
+func (c *metadataCache) close() error {
+	return c.db.Close()
+}
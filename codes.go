@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// failedCodesFile collects the codes a -codes run couldn't scrape, in the
+// same format so it can be fed back with -codes
+const failedCodesFile = "failed.txt"
+
+// readCodes reads one code per line from path. Blank lines and everything
+// after a # are ignored.
+func readCodes(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening codes file: %v", err)
+	}
+	defer f.Close()
+
+	var codes []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if line = strings.TrimSpace(line); line != "" {
+			codes = append(codes, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading codes file: %v", err)
+	}
+	return codes, nil
+}
+
+// runCodes scrapes every code listed in path and saves its nfo and artwork
+// into <OutputDir>/<CODE>/, without any video file. Failed codes don't stop
+// the batch, they are written to failedCodesFile.
+func runCodes(ctx context.Context, f *fetcher, path string, cfg Config) (scraped, failed int, err error) {
+	if cfg.OutputDir == "" {
+		return 0, 0, fmt.Errorf("-codes needs output_dir to be set")
+	}
+	codes, err := readCodes(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	slog.Info("Read codes", "file", path, "count", len(codes))
+
+	var mu sync.Mutex
+	failures := make([]string, len(codes))
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(cfg.Concurrency, 1))
+	for i, code := range codes {
+		g.Go(func() error {
+			if ctx.Err() != nil {
+				return nil
+			}
+			err := scrapeCode(ctx, f, code, cfg)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				slog.Warn("Error scraping", "code", code, "err", err)
+				failures[i] = fmt.Sprintf("%s # %v", code, err)
+				failed++
+			} else {
+				scraped++
+			}
+			return nil
+		})
+	}
+	g.Wait()
+
+	if failed > 0 {
+		var b strings.Builder
+		for _, line := range failures {
+			if line != "" {
+				b.WriteString(line + "\n")
+			}
+		}
+		if err := os.WriteFile(failedCodesFile, []byte(b.String()), 0644); err != nil {
+			return scraped, failed, fmt.Errorf("error writing %s: %v", failedCodesFile, err)
+		}
+		slog.Info("Wrote failed codes", "file", failedCodesFile, "count", failed)
+	}
+	return scraped, failed, nil
+}
+
+// scrapeCode saves the nfo and artwork of one code into its own folder
+func scrapeCode(ctx context.Context, f *fetcher, listed string, cfg Config) error {
+	code, subtitled := normalizeLookupCode(listed, cfg)
+	info, err := scrapeMovie(ctx, f, code, cfg)
+	if err != nil {
+		return err
+	}
+	info = enrichInfo(info, code, cfg)
+	info.Subtitled = subtitled
+
+	name := sanitizeFolderName(applyCodeCase(code, listed, cfg))
+	dir := filepath.Join(cfg.OutputDir, name)
+	basePath := filepath.Join(dir, name)
+	if cfg.DryRun {
+		slog.Info("Would write", "code", code, "nfo", basePath+".nfo")
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating folder: %v", err)
+	}
+
+	if cfg.ActorThumbs {
+		info.ActorThumbs = downloadActorThumbs(ctx, f, info, dir)
+	}
+	nfoWriter := nfoWriterFor(cfg)
+	written, err := writeNFO(basePath+".nfo", info, nfoWriter, cfg.Force)
+	if err != nil {
+		return err
+	}
+	if written {
+		slog.Info("Scraped", "code", code, "nfo", basePath+".nfo")
+	} else {
+		slog.Info("Kept existing nfo, use -force to replace it", "code", code, "nfo", basePath+".nfo")
+	}
+	if err := downloadArtwork(ctx, f, info, basePath, nfoWriter, cfg); err != nil {
+		slog.Warn("Error downloading artwork", "code", code, "err", err)
+	}
+	if cfg.DownloadSamples {
+		if err := downloadSamples(ctx, f, info, dir, cfg); err != nil {
+			slog.Warn("Error downloading sample images", "code", code, "err", err)
+		}
+	}
+	if cfg.DownloadTrailer {
+		if err := downloadTrailer(ctx, f, info, basePath); err != nil {
+			slog.Warn("Error downloading trailer", "code", code, "err", err)
+		}
+	}
+	return nil
+}
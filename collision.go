@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// collisionPolicies are the values allowed for Config.CollisionPolicy
+var collisionPolicies = []string{"suffix", "trash", "skip"}
+
+// defaultCollisionFormat is the CollisionFormat used when none is set
+const defaultCollisionFormat = "_%d"
+
+// collisionVerbPattern matches the integer verbs CollisionFormat may use,
+// with their flags and width
+var collisionVerbPattern = regexp.MustCompile(`%[-+ #0]*[0-9]*[dxXob]`)
+
+// validateCollisionFormat checks that format has exactly one integer verb,
+// no other verbs and no path separators
+func validateCollisionFormat(format string) error {
+	rest := strings.ReplaceAll(format, "%%", "")
+	if n := len(collisionVerbPattern.FindAllString(rest, -1)); n != 1 || strings.Count(rest, "%") != 1 {
+		return fmt.Errorf("must contain exactly one integer verb such as %%d")
+	}
+	if strings.ContainsAny(fmt.Sprintf(format, 1), `/\`) {
+		return fmt.Errorf("must not contain path separators")
+	}
+	return nil
+}
+
+// trashDir is the folder next to a target that the trash policy moves the
+// file it replaces into. The walk and the watcher leave it alone.
+const trashDir = ".trash"
+
+// originSuffix names the sidecar next to a trashed file holding the path it
+// was moved from
+const originSuffix = ".origin"
+
+// resolveCollision returns the path src should be moved to when target
+// already exists, according to cfg.CollisionPolicy. dest is empty when the
+// skip policy leaves src where it is. collided reports whether another file
+// had the name. A target that already holds src's copy or link from an
+// earlier run is returned as is, see alreadyTransferred. Callers hold
+// renameMu.
+func resolveCollision(ctx context.Context, src, target string, cfg Config) (dest string, collided bool, err error) {
+	// Case-only renames on case-insensitive filesystems find src itself
+	if !pathTaken(ctx, src, target, cfg) {
+		return target, false, nil
+	}
+
+	switch cfg.CollisionPolicy {
+	case "skip":
+		return "", true, nil
+	case "trash":
+		if reservedPaths[filepath.Clean(target)] {
+			// Another file is still being moved there, it can't be trashed yet
+			break
+		}
+		if cfg.DryRun {
+			slog.Info("Would move to trash", "file", target)
+			return target, true, nil
+		}
+		if err := moveToTrash(ctx, target, cfg); err != nil {
+			return "", true, err
+		}
+		return target, true, nil
+	}
+	return getUniqueFilePath(ctx, src, target, cfg), true, nil
+}
+
+// pathTaken reports whether path is reserved by a transfer in progress, or
+// exists and holds something else than src, or in the copy and link modes,
+// src's copy or link. Callers hold renameMu.
+func pathTaken(ctx context.Context, src, path string, cfg Config) bool {
+	if reservedPaths[filepath.Clean(path)] {
+		return true
+	}
+	existing, err := os.Lstat(path)
+	if err != nil {
+		return false
+	}
+	return !isTransferOf(ctx, src, path, existing, linkMode(cfg))
+}
+
+// alreadyTransferred reports whether dst is an existing copy or link of src
+// that an earlier run in the copy and link modes made, so there is nothing
+// left to transfer
+func alreadyTransferred(ctx context.Context, src, dst string, cfg Config) bool {
+	mode := linkMode(cfg)
+	if mode == "move" {
+		return false
+	}
+	existing, err := os.Lstat(dst)
+	return err == nil && isTransferOf(ctx, src, dst, existing, mode)
+}
+
+// isTransferOf reports whether path, described by existing, is what mode
+// makes of src. In move mode that is src itself under the same name up to
+// case, a hardlink elsewhere is a different file to rename onto. Symlinks
+// must point at src, hardlinks share its inode, and copies, which links
+// fall back to across filesystems, need the same size and quickHash.
+func isTransferOf(ctx context.Context, src, path string, existing os.FileInfo, mode string) bool {
+	if src == "" {
+		return false
+	}
+	current, err := os.Stat(src)
+	if err != nil {
+		return false
+	}
+	srcAbs, err := filepath.Abs(src)
+	if err != nil {
+		return false
+	}
+
+	if mode == "move" {
+		pathAbs, err := filepath.Abs(path)
+		if err != nil || !strings.EqualFold(srcAbs, pathAbs) {
+			return false
+		}
+		existing, err = os.Stat(path)
+		return err == nil && os.SameFile(current, existing)
+	}
+	if existing.Mode()&fs.ModeSymlink != 0 {
+		link, err := os.Readlink(path)
+		return mode == "symlink" && err == nil && link == srcAbs
+	}
+	if os.SameFile(current, existing) {
+		return true
+	}
+	return existing.Mode().IsRegular() && existing.Size() == current.Size() && sameQuickHash(ctx, src, path)
+}
+
+// sameQuickHash reports whether a and b have the same quickHash
+func sameQuickHash(ctx context.Context, a, b string) bool {
+	hashA, err := quickHash(ctx, a)
+	if err != nil {
+		return false
+	}
+	hashB, err := quickHash(ctx, b)
+	return err == nil && hashA == hashB
+}
+
+// moveToTrash moves path into the trash folder next to it, named with
+// CollisionFormat if the trash has the name already, and records its original path in an
+// origin sidecar. The move is logged for -undo too.
+func moveToTrash(ctx context.Context, path string, cfg Config) error {
+	dir := filepath.Join(filepath.Dir(path), trashDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating trash folder: %v", err)
+	}
+	dest := getUniqueFilePath(ctx, "", filepath.Join(dir, filepath.Base(path)), cfg)
+	if err := os.Rename(path, dest); err != nil {
+		return fmt.Errorf("error moving %s to trash: %v", path, err)
+	}
+	slog.Info("Moved to trash", "file", path, "to", dest)
+
+	origin, err := filepath.Abs(path)
+	if err != nil {
+		origin = path
+	}
+	if err := os.WriteFile(dest+originSuffix, []byte(origin+"\n"), 0644); err != nil {
+		slog.Warn("Error writing trash origin", "file", dest, "err", err)
+	}
+	if err := appendUndoEntry(undoLogFile, path, dest); err != nil {
+		slog.Warn("Error recording undo entry", "file", path, "err", err)
+	}
+	return nil
+}
+
+// inTrash reports whether path lies inside a trash folder
+func inTrash(path string) bool {
+	for _, part := range strings.Split(filepath.ToSlash(path), "/") {
+		if part == trashDir {
+			return true
+		}
+	}
+	return false
+}
+
+// collision lists the files that all reduce to the same target name
+type collision struct {
+	Target string
+	Files  []string
+}
+
+// findCollisions groups results by the name they were meant to get and
+// returns the groups that collided, either with each other or with a file
+// that was already there. A dry run doesn't reserve names, so there two
+// files with the same new path collide as well.
+func findCollisions(results []fileResult) []collision {
+	byTarget := make(map[string][]string)
+	collided := make(map[string]bool)
+	var targets []string
+	for _, result := range results {
+		target := result.NewPath
+		if result.Collision != "" {
+			target = result.Collision
+			collided[target] = true
+		}
+		if _, ok := byTarget[target]; !ok {
+			targets = append(targets, target)
+		}
+		byTarget[target] = append(byTarget[target], result.File)
+	}
+
+	var collisions []collision
+	for _, target := range targets {
+		if files := byTarget[target]; len(files) > 1 || collided[target] {
+			collisions = append(collisions, collision{Target: target, Files: files})
+		}
+	}
+	return collisions
+}
+
+// logCollisions prints the collisions section of the run summary
+func logCollisions(collisions []collision) {
+	if len(collisions) == 0 {
+		return
+	}
+	slog.Warn(fmt.Sprintf("%d potential collisions, review these", len(collisions)))
+	for _, c := range collisions {
+		slog.Warn("Collision", "target", c.Target, "files", strings.Join(slices.Sorted(slices.Values(c.Files)), ", "))
+	}
+}
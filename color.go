@@ -0,0 +1,42 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// colorOutput turns on colored console messages, see setColorOutput
+var colorOutput bool
+
+// ANSI escape codes of the console colors
+const (
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorReset  = "\033[0m"
+)
+
+// setColorOutput enables colors when the console is a terminal, unless
+// -no-color is given or NO_COLOR is set (https://no-color.org)
+func setColorOutput(noColor bool) {
+	f, ok := consoleOut.(*os.File)
+	colorOutput = ok && isTerminal(f) && !noColor && os.Getenv("NO_COLOR") == ""
+}
+
+// colorize wraps a console line in the color for its level and message:
+// red for errors, yellow for warnings and skips, green for renames
+func colorize(level slog.Level, msg, line string) string {
+	var color string
+	switch {
+	case level >= slog.LevelError:
+		color = colorRed
+	case level >= slog.LevelWarn, strings.HasPrefix(msg, "Skipped"):
+		color = colorYellow
+	case msg == "Renamed":
+		color = colorGreen
+	default:
+		return line
+	}
+	return color + line + colorReset
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// configFormat picks the config file format from its extension: yaml, toml,
+// or json for anything else
+func configFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	default:
+		return "json"
+	}
+}
+
+// marshalConfig encodes cfg in the given format
+func marshalConfig(cfg Config, format string) ([]byte, error) {
+	switch format {
+	case "yaml":
+		return yaml.Marshal(cfg)
+	case "toml":
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(cfg); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return json.MarshalIndent(cfg, "", "    ")
+	}
+}
+
+// unmarshalConfig decodes data in the given format into cfg
+func unmarshalConfig(data []byte, format string, cfg *Config) error {
+	switch format {
+	case "yaml":
+		return yaml.Unmarshal(data, cfg)
+	case "toml":
+		return toml.Unmarshal(data, cfg)
+	default:
+		return json.Unmarshal(data, cfg)
+	}
+}
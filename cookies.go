@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sourceSites are the pages of each scraper that user cookies are scoped to
+var sourceSites = map[string]string{
+	"javbus":     javbusBaseURL,
+	"javlibrary": javlibrarySearchURL,
+}
+
+// addUserCookies puts the cookies from Cookies and CookieFile into jar. The
+// jar only sends them back to the source host they were set for, so they
+// never follow a redirect to another site.
+func addUserCookies(jar *cookiejar.Jar, cfg Config) error {
+	for source, header := range cfg.Cookies {
+		site, ok := sourceSites[source]
+		if !ok {
+			// Unknown sources are reported by validateConfig
+			continue
+		}
+		u, err := url.Parse(site)
+		if err != nil {
+			continue
+		}
+		cookies, err := http.ParseCookie(header)
+		if err != nil {
+			return fmt.Errorf("error parsing cookies for %s: %v", source, err)
+		}
+		for _, c := range cookies {
+			c.Path = "/"
+		}
+		jar.SetCookies(u, cookies)
+	}
+
+	if cfg.CookieFile != "" {
+		if err := loadCookieFile(jar, cfg.CookieFile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadCookieFile reads a Netscape cookies.txt, as exported by browser
+// extensions, keeping only the cookies for source hosts
+func loadCookieFile(jar *cookiejar.Jar, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening cookie file: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		line, httpOnly := strings.CutPrefix(line, "#HttpOnly_")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// domain, include subdomains, path, secure, expiry, name, value
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return fmt.Errorf("error parsing cookie file line %d: expected 7 tab-separated fields", lineNo)
+		}
+		expiry, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return fmt.Errorf("error parsing cookie file line %d: %v", lineNo, err)
+		}
+
+		domain := strings.TrimPrefix(fields[0], ".")
+		u := sourceSiteFor(domain)
+		if u == nil {
+			continue
+		}
+		cookie := &http.Cookie{
+			Name:     fields[5],
+			Value:    fields[6],
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			HttpOnly: httpOnly,
+		}
+		if strings.EqualFold(fields[1], "TRUE") {
+			cookie.Domain = domain
+		}
+		if expiry > 0 {
+			cookie.Expires = time.Unix(expiry, 0)
+		}
+		jar.SetCookies(u, []*http.Cookie{cookie})
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading cookie file: %v", err)
+	}
+	return nil
+}
+
+// sourceSiteFor returns the source site URL served by domain, or nil when
+// the domain isn't one of the sources
+func sourceSiteFor(domain string) *url.URL {
+	for _, site := range sourceSites {
+		u, err := url.Parse(site)
+		if err != nil {
+			continue
+		}
+		host := u.Hostname()
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return u
+		}
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// quickHashChunk is how much of the head and tail of a file quickHash reads
+const quickHashChunk = 1 << 20
+
+// quickHash fingerprints a file from its size plus the first and last 1MB,
+// which is enough to tell apart different movies without reading gigabytes.
+// Reads stop with ctx's error once ctx is done.
+func quickHash(ctx context.Context, path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("error opening %s: %v", path, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", fmt.Errorf("error reading %s: %v", path, err)
+	}
+	size := info.Size()
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%d:", size)
+	if _, err := io.CopyN(h, contextReader{ctx, f}, min(size, quickHashChunk)); err != nil {
+		return "", fmt.Errorf("error hashing %s: %v", path, err)
+	}
+	if size > quickHashChunk {
+		tail := max(size-quickHashChunk, quickHashChunk)
+		if _, err := f.Seek(tail, io.SeekStart); err != nil {
+			return "", fmt.Errorf("error hashing %s: %v", path, err)
+		}
+		if _, err := io.Copy(h, contextReader{ctx, f}); err != nil {
+			return "", fmt.Errorf("error hashing %s: %v", path, err)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// findDuplicates groups files with identical content, dropping groups of one.
+// Only files of equal size are hashed, each within PerFileTimeout.
+func findDuplicates(ctx context.Context, files []string, cfg Config) [][]string {
+	bySize := make(map[int64][]string)
+	var sizes []int64
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			slog.Warn("Error reading file for dedup", "file", file, "err", err)
+			continue
+		}
+		if _, ok := bySize[info.Size()]; !ok {
+			sizes = append(sizes, info.Size())
+		}
+		bySize[info.Size()] = append(bySize[info.Size()], file)
+	}
+
+	var groups [][]string
+	for _, size := range sizes {
+		candidates := bySize[size]
+		if len(candidates) < 2 {
+			continue
+		}
+		byHash := make(map[string][]string)
+		var hashes []string
+		for _, file := range candidates {
+			fileCtx, cancel := stepContext(ctx, cfg)
+			hash, err := quickHash(fileCtx, file)
+			cancel()
+			if ctx.Err() != nil {
+				// Part of a group could be dropped as a duplicate of nothing
+				slog.Warn("Dedup interrupted, keeping every file", "err", ctx.Err())
+				return nil
+			}
+			if err != nil {
+				slog.Warn("Error hashing file for dedup", "file", file, "err", err)
+				continue
+			}
+			if _, ok := byHash[hash]; !ok {
+				hashes = append(hashes, hash)
+			}
+			byHash[hash] = append(byHash[hash], file)
+		}
+		for _, hash := range hashes {
+			if len(byHash[hash]) > 1 {
+				groups = append(groups, byHash[hash])
+			}
+		}
+	}
+	return groups
+}
+
+// findSameCode groups files that extract to the same movie code, i.e.
+// different rips of the same movie. Multi-part files keep their own groups.
+func findSameCode(files []string, cfg Config) [][]string {
+	byCode := make(map[string][]string)
+	var codes []string
+	for _, file := range files {
+		if findFileCode(file, cfg) == "" {
+			continue
+		}
+		movieCode, _ := extractMovieCode(file, cfg)
+		key := strings.ToUpper(strings.TrimSuffix(movieCode, filepath.Ext(movieCode)))
+		if _, ok := byCode[key]; !ok {
+			codes = append(codes, key)
+		}
+		byCode[key] = append(byCode[key], file)
+	}
+
+	var groups [][]string
+	for _, code := range codes {
+		if len(byCode[code]) > 1 {
+			groups = append(groups, byCode[code])
+		}
+	}
+	return groups
+}
+
+// dedupFiles reports exact duplicates and rips of the same code among files,
+// and returns the list with only the best file of each group kept. With
+// remove set the other copies of identical content are deleted from disk.
+// Rips of the same code can be different cuts, they are only deleted when
+// removeSameCode is set as well.
+func dedupFiles(ctx context.Context, files []string, cfg Config, remove, removeSameCode bool) []string {
+	dropped := make(map[string]bool)
+	dropGroup := func(group []string, remove bool) {
+		keep := bestVideo(ctx, group, cfg)
+		var others []string
+		for _, file := range group {
+			if file != keep {
+				others = append(others, file)
+			}
+		}
+		slog.Info("Duplicate group", "keep", keep, "duplicates", others)
+		for _, file := range others {
+			dropped[file] = true
+			if !remove || cfg.DryRun {
+				continue
+			}
+			if err := os.Remove(file); err != nil {
+				slog.Error("Error removing duplicate", "file", file, "err", err)
+				continue
+			}
+			slog.Info("Removed duplicate", "file", file, "keep", keep)
+		}
+	}
+
+	groups := findDuplicates(ctx, files, cfg)
+	for _, group := range groups {
+		dropGroup(group, remove)
+	}
+
+	var remaining []string
+	for _, file := range files {
+		if !dropped[file] {
+			remaining = append(remaining, file)
+		}
+	}
+	sameCode := findSameCode(remaining, cfg)
+	for _, group := range sameCode {
+		dropGroup(group, remove && removeSameCode)
+	}
+	if len(groups)+len(sameCode) == 0 {
+		return files
+	}
+	slog.Info(fmt.Sprintf("Found %d duplicate groups", len(groups)+len(sameCode)))
+
+	var kept []string
+	for _, file := range files {
+		if !dropped[file] {
+			kept = append(kept, file)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestQuickHashCancelled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ABC-123.mp4")
+	if err := os.WriteFile(path, make([]byte, 3*quickHashChunk), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := quickHash(context.Background(), path); err != nil {
+		t.Fatalf("quickHash: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := quickHash(ctx, path); err == nil {
+		t.Error("quickHash with a cancelled context succeeded")
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// regexPrefix marks an ExcludePatterns or Overrides entry as a regular
+// expression instead of a glob or file name
+const regexPrefix = "re:"
+
+// isExcluded reports whether path matches one of the exclude patterns. Globs
+// are matched against the base name and the slash-separated path, regexes
+// against the path with a trailing slash for directories, all
+// case-insensitively.
+func isExcluded(path string, isDir bool, patterns []string) bool {
+	lowerPath := strings.ToLower(filepath.ToSlash(path))
+	lowerBase := strings.ToLower(filepath.Base(path))
+
+	for _, pattern := range patterns {
+		if expr, ok := strings.CutPrefix(pattern, regexPrefix); ok {
+			target := lowerPath
+			if isDir {
+				target += "/"
+			}
+			re, err := compilePattern("(?i)" + expr)
+			if err == nil && re.MatchString(target) {
+				return true
+			}
+			continue
+		}
+
+		glob := strings.ToLower(filepath.ToSlash(pattern))
+		if ok, _ := filepath.Match(glob, lowerBase); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(glob, lowerPath); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// junkNames are files and folders that systems and NAS boxes leave behind,
+// lowercased. Dotfiles such as .DS_Store and ._ AppleDouble files are hidden
+// anyway.
+var junkNames = map[string]bool{
+	"thumbs.db":    true,
+	"desktop.ini":  true,
+	"@eadir":       true,
+	"$recycle.bin": true,
+}
+
+// isHiddenOrJunk reports whether the base name of path is a dotfile or one
+// of junkNames
+func isHiddenOrJunk(path string) bool {
+	name := filepath.Base(path)
+	return strings.HasPrefix(name, ".") || junkNames[strings.ToLower(name)]
+}
+
+// isIncluded reports whether the base name of path matches one of globs,
+// case-insensitively. An empty list includes everything.
+func isIncluded(path string, globs []string) bool {
+	if len(globs) == 0 {
+		return true
+	}
+	lowerBase := strings.ToLower(filepath.Base(path))
+	for _, glob := range globs {
+		if ok, _ := filepath.Match(strings.ToLower(glob), lowerBase); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// validateExcludePattern checks that pattern is a valid glob or regex
+func validateExcludePattern(pattern string) error {
+	if expr, ok := strings.CutPrefix(pattern, regexPrefix); ok {
+		_, err := regexp.Compile("(?i)" + expr)
+		return err
+	}
+	_, err := filepath.Match(pattern, "")
+	return err
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// indexRecord is one row of the exported index
+type indexRecord struct {
+	OriginalPath string `json:"original_path"`
+	NewPath      string `json:"new_path"`
+	Code         string `json:"code"`
+	Title        string `json:"title"`
+	Studio       string `json:"studio"`
+	ReleaseDate  string `json:"release_date"`
+}
+
+// indexHeader is the CSV header row, in indexRecord field order
+var indexHeader = []string{"original_path", "new_path", "code", "title", "studio", "release_date"}
+
+func newIndexRecords(results []fileResult) []indexRecord {
+	records := make([]indexRecord, 0, len(results))
+	for _, result := range results {
+		records = append(records, indexRecord{
+			OriginalPath: result.File,
+			NewPath:      result.NewPath,
+			Code:         result.Code,
+			Title:        result.Info.Title,
+			Studio:       result.Info.Studio,
+			ReleaseDate:  result.Info.ReleaseDate,
+		})
+	}
+	return records
+}
+
+// exportIndex writes the processed files to index.csv or index.json. Files
+// that failed to scrape are included with empty metadata.
+func exportIndex(format string, results []fileResult) error {
+	records := newIndexRecords(results)
+	path := "index." + format
+
+	var err error
+	switch format {
+	case "csv":
+		err = writeIndexCSV(path, records)
+	case "json":
+		err = writeIndexJSON(path, records)
+	default:
+		return fmt.Errorf("unknown export format %q", format)
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("Exported index", "file", path, "count", len(records))
+	return nil
+}
+
+func writeIndexCSV(path string, records []indexRecord) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %v", path, err)
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write(indexHeader)
+	for _, r := range records {
+		w.Write([]string{r.OriginalPath, r.NewPath, r.Code, r.Title, r.Studio, r.ReleaseDate})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("error writing %s: %v", path, err)
+	}
+	return nil
+}
+
+// indexJSON is the layout of index.json, the version telling which build
+// wrote it
+type indexJSON struct {
+	Version string        `json:"version"`
+	Created time.Time     `json:"created"`
+	Records []indexRecord `json:"records"`
+}
+
+func writeIndexJSON(path string, records []indexRecord) error {
+	index := indexJSON{Version: versionString(), Created: time.Now(), Records: records}
+	data, err := json.MarshalIndent(index, "", "    ")
+	if err != nil {
+		return fmt.Errorf("error encoding index: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("error writing %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+package main
+
+import "testing"
+
+func TestMatchFC2(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"fc2-ppv-123", "FC2-PPV-123"},
+		{"FC2PPV123", "FC2-PPV-123"},
+		{"fc2ppv-1234567", "FC2-PPV-1234567"},
+		{"FC2_PPV_1234567", "FC2-PPV-1234567"},
+		{"FC2 PPV 1234567", "FC2-PPV-1234567"},
+		{"ABC-123", ""},
+		{"FC2-123", ""},
+	}
+	for _, tt := range tests {
+		if got := matchFC2(tt.name); got != tt.want {
+			t.Errorf("matchFC2(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExtractMovieCodeFC2(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     string
+	}{
+		{"fc2-ppv-123.mp4", "FC2-PPV-123.mp4"},
+		{"FC2PPV123.mkv", "FC2-PPV-123.mkv"},
+		{"[somesite.com]FC2-PPV-123.mp4", "FC2-PPV-123.mp4"},
+		{"/videos/fc2ppv-1234567.avi", "FC2-PPV-1234567.avi"},
+		{"ABC-123.mp4", "ABC-123.mp4"},
+	}
+	for _, tt := range tests {
+		if got, _ := extractMovieCode(tt.filename, Config{}); got != tt.want {
+			t.Errorf("extractMovieCode(%q) = %q, want %q", tt.filename, got, tt.want)
+		}
+	}
+}
+
+func TestMatchDateCode(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"100119_001", "100119_001"},
+		{"010120-123", "010120_123"},
+		{"1pondo_100119_001", "100119_001"},
+		{"Carib-010120-123", "010120_123"},
+		{"caribbeancom 122719-001", "122719_001"},
+		{"10musume_091519_01", "091519_01"},
+		{"ABC-123", ""},
+		{"1234567_001", ""},
+		{"100119_0001", ""},
+	}
+	for _, tt := range tests {
+		if got := matchDateCode(tt.name); got != tt.want {
+			t.Errorf("matchDateCode(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExtractMovieCodeDate(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     string
+	}{
+		{"100119_001.mp4", "100119_001.mp4"},
+		{"1pondo_100119_001.mp4", "100119_001.mp4"},
+		{"Carib-010120-123.mkv", "010120_123.mkv"},
+		{"10musume_091519_01.avi", "091519_01.avi"},
+	}
+	for _, tt := range tests {
+		if got, _ := extractMovieCode(tt.filename, Config{}); got != tt.want {
+			t.Errorf("extractMovieCode(%q) = %q, want %q", tt.filename, got, tt.want)
+		}
+	}
+}
+
+func TestPadCodeNumber(t *testing.T) {
+	tests := []struct {
+		code  string
+		width int
+		want  string
+	}{
+		{"ABC-7", 3, "ABC-007"},
+		{"ABC-12", 5, "ABC-00012"},
+		{"ABC-007", 3, "ABC-007"},
+		{"ABC-12345", 3, "ABC-12345"},
+		{"ABC-7-C", 3, "ABC-007-C"},
+		{"ABC-7", 0, "ABC-7"},
+		{"ABC", 3, "ABC"},
+	}
+	for _, tt := range tests {
+		if got := padCodeNumber(tt.code, tt.width); got != tt.want {
+			t.Errorf("padCodeNumber(%q, %d) = %q, want %q", tt.code, tt.width, got, tt.want)
+		}
+	}
+}
+
+func TestExtractMovieCodePadNumbers(t *testing.T) {
+	tests := []struct {
+		filename string
+		width    int
+		want     string
+	}{
+		{"abc-7.mp4", 3, "ABC-007.mp4"},
+		{"abc-7-c.mp4", 3, "ABC-007-C.mp4"},
+		{"ABC-1234.mp4", 3, "ABC-1234.mp4"},
+		{"FC2-PPV-123.mp4", 8, "FC2-PPV-123.mp4"},
+		{"100119_01.mp4", 5, "100119_01.mp4"},
+	}
+	for _, tt := range tests {
+		if got, _ := extractMovieCode(tt.filename, Config{PadNumbers: tt.width}); got != tt.want {
+			t.Errorf("extractMovieCode(%q) with width %d = %q, want %q", tt.filename, tt.width, got, tt.want)
+		}
+	}
+}
+
+func TestMatchTokyoHot(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Tokyo-Hot-n1234", "n1234"},
+		{"Tokyo Hot N1234 HD", "n1234"},
+		{"tokyohot_k0987", "k0987"},
+		{"n1234", "n1234"},
+		{"n12345", ""},
+		{"abcn1234", ""},
+	}
+	for _, tt := range tests {
+		if got := matchTokyoHot(tt.name); got != tt.want {
+			t.Errorf("matchTokyoHot(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExtractMovieCodeTokyoHot(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     string
+	}{
+		{"Tokyo-Hot-n1234.mp4", "n1234.mp4"},
+		{"n1234.avi", "n1234.avi"},
+		{"[tokyo-hot] k0987.mp4", "k0987.mp4"},
+		// Regular codes are tried first
+		{"ABC-123 n1234.mp4", "ABC-123.mp4"},
+		{"ABC-123.mp4", "ABC-123.mp4"},
+	}
+	for _, tt := range tests {
+		if got, _ := extractMovieCode(tt.filename, Config{}); got != tt.want {
+			t.Errorf("extractMovieCode(%q) = %q, want %q", tt.filename, got, tt.want)
+		}
+	}
+}
+
+func TestStripTags(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"ABC-123-FHD-UncleJack.mp4", "ABC-123-FHD.mp4"},
+		{"ABC-123@somesite.mp4", "ABC-123.mp4"},
+		{"hhd800.com@ABC-123.mp4", "ABC-123.mp4"},
+		{"ABC-123-C-UncleJack.mp4", "ABC-123-C.mp4"},
+		{"ABC-123-UC.mp4", "ABC-123-UC.mp4"},
+		{"ABC-123-part1.mp4", "ABC-123-part1.mp4"},
+		{"ABC-123__-__x.mp4", "ABC-123_x.mp4"},
+	}
+	for _, tt := range tests {
+		if got := stripTags(tt.name); got != tt.want {
+			t.Errorf("stripTags(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExtractMovieCodeTags(t *testing.T) {
+	tests := []struct {
+		filename  string
+		want      string
+		subtitled bool
+	}{
+		{"ABC-123-FHD-UncleJack.mp4", "ABC-123.mp4", false},
+		{"ABC-123@somesite.mp4", "ABC-123.mp4", false},
+		{"hhd800.com@ABC-123.mp4", "ABC-123.mp4", false},
+		{"ABC-123-C-UncleJack.mp4", "ABC-123-C.mp4", true},
+		{"hhd800.com@abc-123-uc.mkv", "ABC-123-UC.mkv", true},
+		{"abc-123--uc.mp4", "ABC-123-UC.mp4", true},
+	}
+	for _, tt := range tests {
+		got, subtitled := extractMovieCode(tt.filename, Config{})
+		if got != tt.want || subtitled != tt.subtitled {
+			t.Errorf("extractMovieCode(%q) = %q, %v, want %q, %v", tt.filename, got, subtitled, tt.want, tt.subtitled)
+		}
+	}
+}
+
+func TestMatchSeparatedCode(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"ABC.123", "ABC-123"},
+		{"abc 123", "ABC-123"},
+		{"abc. 123", "ABC-123"},
+		{"My.Movie.ABC.123-C", "ABC-123-C"},
+		{"Part 2", ""},
+		{"My Movie Part 12", ""},
+		{"Vacation.Video.2020", ""},
+		{"DVD 2020", ""},
+		{"HEYZO 1234", "HEYZO-1234"},
+	}
+	for _, tt := range tests {
+		if got := matchSeparatedCode(tt.name); got != tt.want {
+			t.Errorf("matchSeparatedCode(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExtractMovieCodeNotCode(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     string
+	}{
+		{"ABC.123.mp4", "ABC-123.mp4"},
+		{"ABC 123.mkv", "ABC-123.mkv"},
+		{"Part 2.mp4", "Part 2.mp4"},
+		{"Vacation.Video.2020.mp4", "Vacation.Video.2020.mp4"},
+		{"IMG-2023.mp4", "IMG-2023.mp4"},
+		{"DVD-2020.mp4", "DVD-2020.mp4"},
+		{"HEYZO-1234.mp4", "HEYZO-1234.mp4"},
+		{"Vacation ABC-123.mp4", "ABC-123.mp4"},
+	}
+	for _, tt := range tests {
+		if got, _ := extractMovieCode(tt.filename, Config{}); got != tt.want {
+			t.Errorf("extractMovieCode(%q) = %q, want %q", tt.filename, got, tt.want)
+		}
+	}
+}
+
+func TestMatchDashlessCode(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"SIRO12345", "SIRO-12345"},
+		{"MIAA012", "MIAA-012"},
+		{"siro12345-c", "SIRO-12345-C"},
+		{"movie.x264", ""},
+		{"x264.1080p", ""},
+		{"HEVC265", ""},
+		{"ABC12", ""},
+	}
+	for _, tt := range tests {
+		if got := matchDashlessCode(tt.name); got != tt.want {
+			t.Errorf("matchDashlessCode(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExtractMovieCodeDashless(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     string
+	}{
+		{"SIRO12345.mp4", "SIRO-12345.mp4"},
+		{"MIAA012.mkv", "MIAA-012.mkv"},
+		{"movie.x264.mp4", "movie.x264.mp4"},
+		// The dashed code wins over the encoder name
+		{"ABC-123.x264.mp4", "ABC-123.mp4"},
+	}
+	for _, tt := range tests {
+		if got, _ := extractMovieCode(tt.filename, Config{}); got != tt.want {
+			t.Errorf("extractMovieCode(%q) = %q, want %q", tt.filename, got, tt.want)
+		}
+	}
+}
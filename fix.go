@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// nfoCodeFields are the parts of an existing nfo that can hold the code
+type nfoCodeFields struct {
+	UniqueIDs []string `xml:"uniqueid"`
+	Title     string   `xml:"title"`
+}
+
+// prepareFix picks the files -fix works on: those without a code in their
+// name. For each it tries to recover the code and turns it into an override,
+// so the normal processing renames them. The files where nothing was found
+// are returned separately.
+func prepareFix(ctx context.Context, files []string, cfg Config) ([]string, Config, []string) {
+	var fixable, unrecovered []string
+	overrides := maps.Clone(cfg.Overrides)
+	if overrides == nil {
+		overrides = make(map[string]string)
+	}
+
+	for _, file := range files {
+		if findFileCode(file, cfg) != "" {
+			continue
+		}
+		fileCtx, cancel := stepContext(ctx, cfg)
+		code := recoverCode(fileCtx, file, cfg)
+		cancel()
+		if code == "" {
+			unrecovered = append(unrecovered, file)
+			continue
+		}
+		// Keyed on the path, same-named files elsewhere have their own code
+		overrides[file] = code
+		fixable = append(fixable, file)
+	}
+
+	cfg.Overrides = overrides
+	return fixable, cfg, unrecovered
+}
+
+// recoverCode looks for the code of file in a sibling .nfo and then in the
+// container title, returning "" when neither has one
+func recoverCode(ctx context.Context, file string, cfg Config) string {
+	nfoPath := strings.TrimSuffix(file, filepath.Ext(file)) + ".nfo"
+	if data, err := os.ReadFile(nfoPath); err == nil {
+		var fields nfoCodeFields
+		if xml.Unmarshal(data, &fields) == nil {
+			for _, id := range fields.UniqueIDs {
+				if code := findMovieCode(strings.TrimSpace(id), cfg); code != "" {
+					return code
+				}
+			}
+			if code := findMovieCode(fields.Title, cfg); code != "" {
+				return code
+			}
+		}
+	}
+
+	if title := probeTitle(ctx, file, cfg); title != "" {
+		return findMovieCode(title, cfg)
+	}
+	return ""
+}
+
+// probeTitle returns the title tag of the container with ffprobe, "" when
+// there is none, ffprobe isn't available or ctx ends first
+func probeTitle(ctx context.Context, path string, cfg Config) string {
+	out, err := exec.CommandContext(ctx, ffprobeBinary(cfg),
+		"-v", "error",
+		"-show_entries", "format_tags=title",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		path,
+	).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"log/slog"
+	"slices"
+)
+
+// translateGenres maps genres through genreMap, keeping the ones it doesn't
+// know and dropping empty ones and the duplicates the mapping creates
+func translateGenres(genres []string, genreMap map[string]string) []string {
+	if len(genreMap) == 0 || len(genres) == 0 {
+		return genres
+	}
+
+	translated := make([]string, 0, len(genres))
+	for _, genre := range genres {
+		if mapped, ok := genreMap[genre]; ok {
+			genre = mapped
+		} else {
+			slog.Debug("Genre not in genre map", "genre", genre)
+		}
+		if genre != "" && !slices.Contains(translated, genre) {
+			translated = append(translated, genre)
+		}
+	}
+	return translated
+}
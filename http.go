@@ -0,0 +1,541 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// ageCheckCookies skip the age confirmation page of each source site
+var ageCheckCookies = map[string][]*http.Cookie{
+	javbusBaseURL:       {{Name: "existmag", Value: "all"}},
+	javlibrarySearchURL: {{Name: "over18", Value: "18"}},
+}
+
+// defaultTimeout bounds a request when the config doesn't set Timeout
+const defaultTimeout = 30 * time.Second
+
+// defaultUserAgent looks like a desktop browser, some sources turn away
+// Go's default one
+const defaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+
+// defaultMaxIdleConns is used when the config doesn't set MaxIdleConns. It
+// is well above the default concurrency, which matters because almost every
+// request goes to the same one or two hosts.
+const defaultMaxIdleConns = 32
+
+// requestTimeout returns the configured per-request timeout
+func requestTimeout(cfg Config) time.Duration {
+	if cfg.Timeout <= 0 {
+		return defaultTimeout
+	}
+	return time.Duration(cfg.Timeout) * time.Second
+}
+
+// newHTTPClient builds the HTTP client shared by all scraping and download requests
+func newHTTPClient(cfg Config) (*http.Client, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cookie jar: %v", err)
+	}
+	// 跳过年龄确认页面
+	for site, cookies := range ageCheckCookies {
+		if u, err := url.Parse(site); err == nil {
+			jar.SetCookies(u, cookies)
+		}
+	}
+	if err := addUserCookies(jar, cfg); err != nil {
+		return nil, err
+	}
+
+	// One transport for the whole run keeps connections alive between
+	// requests. Accept-Encoding is left to it so responses are gunzipped.
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = defaultMaxIdleConns
+	if cfg.MaxIdleConns > 0 {
+		transport.MaxIdleConns = cfg.MaxIdleConns
+	}
+	transport.MaxIdleConnsPerHost = transport.MaxIdleConns
+	rotator, err := newProxyRotator(cfg)
+	if err != nil {
+		return nil, err
+	}
+	mapped, err := newProxyMap(cfg)
+	if err != nil {
+		return nil, err
+	}
+	transport.Proxy = proxyFunc(rotator, mapped)
+
+	rt := &retryTransport{
+		base:       transport,
+		timeout:    requestTimeout(cfg),
+		maxRetries: cfg.MaxRetries,
+		userAgent:  cfg.UserAgent,
+		proxies:    rotator,
+		mapped:     mapped,
+	}
+	if rt.userAgent == "" {
+		rt.userAgent = defaultUserAgent
+	}
+	if cfg.RequestsPerSecond > 0 {
+		rt.limiter = rate.NewLimiter(rate.Limit(cfg.RequestsPerSecond), 1)
+	}
+	var client http.RoundTripper = rt
+	if cfg.CacheDir != "" && !cfg.NoCache {
+		client = &pageCache{base: rt, dir: cfg.CacheDir, ttl: time.Duration(cfg.CacheTTLHours) * time.Hour}
+	}
+	return &http.Client{Transport: client, Jar: jar}, nil
+}
+
+// directProxy is the ProxyMap value for hosts that must not use a proxy
+const directProxy = "direct"
+
+// proxyFunc returns the transport's Proxy function: the mapped proxy of the
+// request host, else the current proxy of rotator, else the environment's
+// proxy settings. rotator is nil when neither ProxyAddr nor ProxyList is set.
+func proxyFunc(rotator *proxyRotator, mapped proxyMap) func(*http.Request) (*url.URL, error) {
+	fallback := http.ProxyFromEnvironment
+	if rotator != nil {
+		fallback = rotator.proxy
+	}
+	return func(req *http.Request) (*url.URL, error) {
+		if proxyURL, ok := mapped.lookup(req.URL.Hostname()); ok {
+			return proxyURL, nil
+		}
+		return fallback(req)
+	}
+}
+
+// proxyMap is the parsed ProxyMap, nil entries meaning direct. Mapped hosts
+// are pinned to their proxy, a block isn't retried through the rotator.
+type proxyMap map[string]*url.URL
+
+// newProxyMap parses cfg.ProxyMap
+func newProxyMap(cfg Config) (proxyMap, error) {
+	mapped := make(proxyMap, len(cfg.ProxyMap))
+	for prefix, addr := range cfg.ProxyMap {
+		if addr == directProxy {
+			mapped[prefix] = nil
+			continue
+		}
+		proxyURL, err := parseProxy(addr)
+		if err != nil {
+			return nil, err
+		}
+		mapped[prefix] = proxyURL
+	}
+	return mapped, nil
+}
+
+// lookup returns the proxy of the longest prefix of host, ok is false when
+// no prefix matches
+func (m proxyMap) lookup(host string) (proxyURL *url.URL, ok bool) {
+	best := ""
+	for prefix := range m {
+		if strings.HasPrefix(host, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return nil, false
+	}
+	return m[best], true
+}
+
+// parseProxy checks that addr is a proxy URL the transport can use
+func parseProxy(addr string) (*url.URL, error) {
+	proxyURL, err := url.Parse(addr)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing proxy address: %v", err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q (use http:// or socks5://)", proxyURL.Scheme)
+	}
+
+	return proxyURL, nil
+}
+
+// proxyRotator hands out ProxyAddr followed by the ProxyList entries, moving
+// on to the next one when a site blocks the current one
+type proxyRotator struct {
+	mu      sync.Mutex
+	proxies []*url.URL
+	current int
+}
+
+// newProxyRotator returns the rotator over ProxyAddr and ProxyList, nil when
+// both are empty
+func newProxyRotator(cfg Config) (*proxyRotator, error) {
+	var addrs []string
+	if cfg.ProxyAddr != "" {
+		addrs = append(addrs, cfg.ProxyAddr)
+	}
+	addrs = append(addrs, cfg.ProxyList...)
+	if len(addrs) == 0 {
+		return nil, nil
+	}
+
+	r := &proxyRotator{}
+	for _, addr := range addrs {
+		proxyURL, err := parseProxy(addr)
+		if err != nil {
+			return nil, err
+		}
+		r.proxies = append(r.proxies, proxyURL)
+	}
+	return r, nil
+}
+
+// proxy is the transport's Proxy function
+func (r *proxyRotator) proxy(*http.Request) (*url.URL, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.proxies[r.current], nil
+}
+
+// position returns the index of the current proxy, for advance
+func (r *proxyRotator) position() int {
+	if r == nil {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// advance switches to the proxy after the one at index used. Requests
+// blocked at the same time only move the rotation on once.
+func (r *proxyRotator) advance(used int) *url.URL {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.current == used {
+		r.current = (r.current + 1) % len(r.proxies)
+	}
+	return r.proxies[r.current]
+}
+
+// size is the number of proxies to rotate through, 0 for a nil rotator
+func (r *proxyRotator) size() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.proxies)
+}
+
+// errBlocked is returned for requests a site turned away with a 403 or a
+// block page, once every proxy has been tried
+var errBlocked = errors.New("blocked by the site")
+
+// blockPageTitles are titles, lowercased, of the challenge and block pages
+// sites and CDNs serve instead of the real page
+var blockPageTitles = []string{
+	"just a moment...",
+	"attention required! | cloudflare",
+	"access denied",
+	"403 forbidden",
+}
+
+// htmlTitlePattern finds the title of an HTML page
+var htmlTitlePattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// isBlocked reports whether resp is a 403 or a block page. HTML bodies are
+// read to look at their title; resp.Body is replaced so it can still be read.
+func isBlocked(resp *http.Response) (bool, error) {
+	if resp.StatusCode == http.StatusForbidden {
+		return true, nil
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		return false, nil
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{bytes.NewReader(data), resp.Body}
+	if err != nil {
+		return false, fmt.Errorf("error reading %s: %v", resp.Request.URL, err)
+	}
+	m := htmlTitlePattern.FindSubmatch(data)
+	if m == nil {
+		return false, nil
+	}
+	title := strings.ToLower(strings.TrimSpace(string(m[1])))
+	return slices.Contains(blockPageTitles, title), nil
+}
+
+// retryTransport is the round tripper of the shared client. It sets the
+// User-Agent, waits for the request rate limiter and retries failed
+// attempts, so anything holding the *http.Client gets the same behavior.
+type retryTransport struct {
+	base http.RoundTripper
+	// limiter caps the request rate across all goroutines, nil means unlimited
+	limiter *rate.Limiter
+	// timeout bounds each attempt, reading the body included
+	timeout    time.Duration
+	maxRetries int
+	userAgent  string
+	// proxies are rotated through when a site blocks a request, nil
+	// without ProxyAddr and ProxyList
+	proxies *proxyRotator
+	// mapped hosts always go through their ProxyMap entry
+	mapped proxyMap
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", t.userAgent)
+	}
+	// Bodies that can't be replayed only get one proxy, and mapped hosts
+	// only have the one
+	rotations := t.proxies.size()
+	_, pinned := t.mapped.lookup(req.URL.Hostname())
+	if pinned || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+		rotations = min(rotations, 1)
+	}
+
+	for tried := 1; ; tried++ {
+		attemptReq := req
+		if tried > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("error rewinding request body: %v", err)
+			}
+			attemptReq = req.Clone(req.Context())
+			attemptReq.Body = body
+		}
+
+		used := t.proxies.position()
+		resp, err := doWithRetry(t.send, attemptReq, t.maxRetries)
+		if err != nil {
+			return nil, err
+		}
+		blocked, err := isBlocked(resp)
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		if !blocked {
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		if tried >= rotations {
+			if rotations > 1 {
+				return nil, fmt.Errorf("%w on all %d proxies", errBlocked, rotations)
+			}
+			return nil, errBlocked
+		}
+		next := t.proxies.advance(used)
+		slog.Warn("Blocked, switching proxy", "url", req.URL.String(), "proxy", next.Redacted())
+	}
+}
+
+// send makes one attempt once the limiter allows it
+func (t *retryTransport) send(req *http.Request) (*http.Response, error) {
+	if t.limiter != nil {
+		if err := t.limiter.Wait(req.Context()); err != nil {
+			return nil, err
+		}
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnClose releases an attempt's timeout once its body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// fetcher is the HTTP layer shared by every scrape and download call: one
+// client plus the download limit and the metadata cache that apply across
+// all of them
+type fetcher struct {
+	client *http.Client
+	// downloadLimiter caps the bytes per second of all downloads together,
+	// nil means unlimited
+	downloadLimiter *rate.Limiter
+	// cache holds earlier scrape results, nil when CacheDB is unset
+	cache *metadataCache
+}
+
+// newFetcher builds the shared fetcher from cfg
+func newFetcher(cfg Config) (*fetcher, error) {
+	client, err := newHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &fetcher{client: client}
+	if cfg.MaxDownloadKBps > 0 {
+		bytesPerSec := cfg.MaxDownloadKBps * 1024
+		f.downloadLimiter = rate.NewLimiter(rate.Limit(bytesPerSec), bytesPerSec)
+	}
+	if cfg.CacheDB != "" {
+		f.cache, err = openCache(cfg.CacheDB, time.Duration(cfg.CacheTTLHours)*time.Hour)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// close releases the metadata cache
+func (f *fetcher) close() {
+	if f.cache != nil {
+		f.cache.close()
+	}
+}
+
+// get issues a GET for url with extra request headers. Each attempt is
+// bounded by the configured timeout; the whole request, retries included, is
+// cancelled when ctx is.
+func (f *fetcher) get(ctx context.Context, url string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	return f.client.Do(req)
+}
+
+// throttle wraps a download body so reading it respects the shared
+// download limit
+func (f *fetcher) throttle(ctx context.Context, r io.Reader) io.Reader {
+	if f.downloadLimiter == nil {
+		return r
+	}
+	return &throttledReader{ctx: ctx, r: r, limiter: f.downloadLimiter}
+}
+
+// throttledReader takes a token from limiter for every byte it reads
+type throttledReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	// WaitN fails for more tokens than the bucket holds
+	if burst := t.limiter.Burst(); len(p) > burst {
+		p = p[:burst]
+	}
+	n, err := t.r.Read(p)
+	if n > 0 {
+		if waitErr := t.limiter.WaitN(t.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// retryBaseDelay and retryMaxDelay bound the exponential backoff of doWithRetry
+const (
+	retryBaseDelay = time.Second
+	retryMaxDelay  = 30 * time.Second
+)
+
+// maxRetriesLimit is the highest MaxRetries validateConfig accepts
+const maxRetriesLimit = 20
+
+// retryDelay returns the backoff before retry attempt+1: retryBaseDelay
+// doubled attempt times plus up to half of that as jitter, capped at
+// retryMaxDelay
+func retryDelay(attempt int) time.Duration {
+	delay := retryMaxDelay
+	// Far past the cap the shift would overflow
+	if attempt < 30 {
+		delay = min(retryBaseDelay<<attempt, retryMaxDelay)
+	}
+	return min(delay+time.Duration(rand.Int64N(int64(delay)/2+1)), retryMaxDelay)
+}
+
+// doWithRetry sends req through send, retrying connection errors and 429/5xx
+// responses up to maxRetries times with exponential backoff and jitter. A
+// Retry-After header from the server takes precedence over the computed
+// delay. Requests whose body can't be replayed are only tried once.
+func doWithRetry(send func(*http.Request) (*http.Response, error), req *http.Request, maxRetries int) (*http.Response, error) {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		maxRetries = 0
+	}
+
+	for attempt := 0; ; attempt++ {
+		attemptReq := req
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("error rewinding request body: %v", err)
+			}
+			attemptReq = req.Clone(req.Context())
+			attemptReq.Body = body
+		}
+
+		resp, err := send(attemptReq)
+		retryable := err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		if !retryable || attempt >= maxRetries || req.Context().Err() != nil {
+			return resp, err
+		}
+
+		delay := retryDelay(attempt)
+		if resp != nil {
+			if after, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				delay = after
+			}
+			resp.Body.Close()
+		}
+		slog.Debug("Retrying request", "url", req.URL.String(), "attempt", attempt+1, "delay", delay)
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	for _, attempt := range []int{0, 1, 4, 5, 29, 30, 35, 63, 64, 1000} {
+		delay := retryDelay(attempt)
+		if delay < retryBaseDelay || delay > retryMaxDelay {
+			t.Errorf("retryDelay(%d) = %v, want between %v and %v", attempt, delay, retryBaseDelay, retryMaxDelay)
+		}
+	}
+	if delay := retryDelay(0); delay > retryBaseDelay*3/2 {
+		t.Errorf("retryDelay(0) = %v, want at most %v", delay, retryBaseDelay*3/2)
+	}
+	if delay := retryDelay(40); delay != retryMaxDelay {
+		t.Errorf("retryDelay(40) = %v, want %v", delay, retryMaxDelay)
+	}
+}
+
+func TestValidateConfigMaxRetries(t *testing.T) {
+	for _, retries := range []int{-1, maxRetriesLimit + 1, 40} {
+		cfg := Config{FilePath: t.TempDir(), MaxRetries: retries}
+		if err := validateConfig(&cfg); err == nil || !strings.Contains(err.Error(), "max_retries") {
+			t.Errorf("validateConfig with max_retries %d: err = %v, want a max_retries problem", retries, err)
+		}
+	}
+	cfg := Config{FilePath: t.TempDir(), MaxRetries: maxRetriesLimit}
+	if err := validateConfig(&cfg); err != nil && strings.Contains(err.Error(), "max_retries") {
+		t.Errorf("validateConfig with max_retries %d: %v", maxRetriesLimit, err)
+	}
+}
+
+func TestRetryTransportPinsMappedHosts(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		http.Error(w, "blocked", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	cfg := Config{
+		ProxyList: []string{"http://127.0.0.2:1", "http://127.0.0.3:1", "http://127.0.0.4:1"},
+		ProxyMap:  map[string]string{"127.0.0.1": directProxy},
+	}
+	rotator, err := newProxyRotator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapped, err := newProxyMap(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxyFunc(rotator, mapped)
+	client := &http.Client{Transport: &retryTransport{
+		base:    transport,
+		timeout: 5 * time.Second,
+		proxies: rotator,
+		mapped:  mapped,
+	}}
+
+	_, err = client.Get(srv.URL)
+	if !errors.Is(err, errBlocked) {
+		t.Errorf("Get of a blocked mapped host: err = %v, want errBlocked", err)
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("blocked mapped host was tried %d times, want once", n)
+	}
+	if rotator.position() != 0 {
+		t.Errorf("rotator moved on to %d for a mapped host", rotator.position())
+	}
+}
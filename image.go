@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// imageTypes are the content types downloadImage accepts
+var imageTypes = []string{"image/jpeg", "image/png"}
+
+// downloadImage downloads the JPEG or PNG image at url to destPath
+func downloadImage(ctx context.Context, f *fetcher, url, destPath string) error {
+	return downloadFile(ctx, f, url, destPath, imageTypes)
+}
+
+// downloadFile downloads url to destPath, failing unless the data sniffs as
+// one of contentTypes. The data goes to destPath.part first, which is renamed
+// into place once complete; a .part left over from an interrupted download is
+// resumed with a Range request when the server allows it. Downloads cut off by
+// PerFileTimeout remove their .part.
+func downloadFile(ctx context.Context, f *fetcher, url, destPath string, contentTypes []string) error {
+	partPath := destPath + ".part"
+	var offset int64
+	if info, err := os.Stat(partPath); err == nil {
+		offset = info.Size()
+	}
+
+	err := fetchToPart(ctx, f, url, partPath, offset, contentTypes)
+	if errors.Is(err, errRestartDownload) {
+		slog.Debug("Can't resume download, starting over", "url", url)
+		err = fetchToPart(ctx, f, url, partPath, 0, contentTypes)
+	}
+	if err != nil {
+		// Resuming would run into the same per-file timeout again
+		if errors.Is(context.Cause(ctx), errFileTimeout) {
+			os.Remove(partPath)
+		}
+		return err
+	}
+	if err := os.Rename(partPath, destPath); err != nil {
+		return fmt.Errorf("error moving %s into place: %v", destPath, err)
+	}
+	return nil
+}
+
+// errRestartDownload means a resumed download has to start from scratch
+var errRestartDownload = errors.New("download can't be resumed")
+
+// fetchToPart downloads url into partPath, asking for the bytes from offset
+// on when offset is not 0
+func fetchToPart(ctx context.Context, f *fetcher, url, partPath string, offset int64, contentTypes []string) error {
+	var header http.Header
+	if offset > 0 {
+		header = http.Header{"Range": {fmt.Sprintf("bytes=%d-", offset)}}
+	}
+	resp, err := f.get(ctx, url, header)
+	if err != nil {
+		return fmt.Errorf("error fetching %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case offset > 0 && resp.StatusCode == http.StatusPartialContent:
+		// A different start means the file changed on the server
+		if !rangeStartsAt(resp.Header.Get("Content-Range"), offset) {
+			os.Remove(partPath)
+			return errRestartDownload
+		}
+		flags |= os.O_APPEND
+	case offset > 0 && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		os.Remove(partPath)
+		return errRestartDownload
+	case resp.StatusCode == http.StatusOK:
+		// Servers without range support send everything again
+		offset = 0
+		flags |= os.O_TRUNC
+	default:
+		return fmt.Errorf("unexpected status fetching %s: %s", url, resp.Status)
+	}
+
+	body := f.throttle(ctx, resp.Body)
+
+	// Sniff the first bytes so error pages don't get saved as images or
+	// videos; a resumed download was checked when it started
+	var head []byte
+	if offset == 0 {
+		head = make([]byte, 512)
+		n, err := io.ReadFull(body, head)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("error reading %s: %v", url, err)
+		}
+		head = head[:n]
+		if contentType := http.DetectContentType(head); !slices.Contains(contentTypes, contentType) {
+			os.Remove(partPath)
+			return fmt.Errorf("%s is not %s (got %s)", url, strings.Join(contentTypes, " or "), contentType)
+		}
+	}
+
+	out, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %v", partPath, err)
+	}
+	_, err = out.Write(head)
+	if err == nil {
+		_, err = io.Copy(out, body)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// 保留下载了一半的文件，下次从断点继续
+		return fmt.Errorf("error downloading %s: %v", url, err)
+	}
+	return nil
+}
+
+// rangeStartsAt reports whether a Content-Range header such as
+// "bytes 1000-4999/5000" starts at offset
+func rangeStartsAt(contentRange string, offset int64) bool {
+	spec, ok := strings.CutPrefix(contentRange, "bytes ")
+	if !ok {
+		return false
+	}
+	start, _, ok := strings.Cut(spec, "-")
+	if !ok {
+		return false
+	}
+	n, err := strconv.ParseInt(start, 10, 64)
+	return err == nil && n == offset
+}
+
+// sampleDir is the folder next to the video that holds the sample images,
+// where Kodi and Jellyfin look for extra fanart
+const sampleDir = "extrafanart"
+
+// downloadSamples saves the sample images of info as
+// <dir>/extrafanart/sample-NN.jpg, a few at a time. Existing files are kept
+// unless force is set.
+func downloadSamples(ctx context.Context, f *fetcher, info MovieInfo, dir string, cfg Config) error {
+	if len(info.SampleImages) == 0 {
+		return nil
+	}
+	destDir := filepath.Join(dir, sampleDir)
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return fmt.Errorf("error creating %s: %v", destDir, err)
+	}
+
+	workers := cfg.Concurrency
+	if workers <= 0 {
+		workers = defaultConcurrency
+	}
+	var g errgroup.Group
+	g.SetLimit(workers)
+	for i, url := range info.SampleImages {
+		path := filepath.Join(destDir, fmt.Sprintf("sample-%02d.jpg", i+1))
+		if _, err := os.Stat(path); err == nil && !cfg.Force {
+			continue
+		}
+		g.Go(func() error {
+			return downloadImage(ctx, f, url, path)
+		})
+	}
+	return g.Wait()
+}
+
+// downloadArtwork saves the poster and fanart for info next to the video,
+// basePath being the video path without its extension, under the names w
+// uses. A <CODE>.jpg in cfg.LocalArtDir is copied in as the poster instead
+// of downloading one.
+func downloadArtwork(ctx context.Context, f *fetcher, info MovieInfo, basePath string, w NFOWriter, cfg Config) error {
+	posterPath, fanartPath := w.ArtworkPaths(basePath)
+	images := []struct {
+		url   string
+		local string
+		path  string
+	}{
+		{info.PosterURL, localArt(info.Code, cfg.LocalArtDir), posterPath},
+		{info.CoverURL, "", fanartPath},
+	}
+
+	for _, img := range images {
+		if img.url == "" && img.local == "" {
+			continue
+		}
+		if _, err := os.Stat(img.path); err == nil && !cfg.Force {
+			continue
+		}
+		if img.local != "" {
+			if err := copyFile(ctx, img.local, img.path); err != nil {
+				return fmt.Errorf("error copying %s: %v", img.local, err)
+			}
+			slog.Debug("Copied local artwork", "from", img.local, "to", img.path)
+			continue
+		}
+		if err := downloadImage(ctx, f, img.url, img.path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// localArt returns the path of <dir>/<CODE>.jpg, trying the lowercase name
+// too, or "" when dir is unset or has no image for code
+func localArt(code, dir string) string {
+	if dir == "" || code == "" {
+		return ""
+	}
+	for _, name := range []string{code, strings.ToLower(code)} {
+		path := filepath.Join(dir, name+".jpg")
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			return path
+		}
+	}
+	return ""
+}
+
+// actorDir is the folder next to the video holding actor headshots
+const actorDir = ".actors"
+
+// actorThumb is one headshot download shared by every movie of the run.
+// mu is held while it downloads, so the other movies wait for the result.
+type actorThumb struct {
+	mu   sync.Mutex
+	done bool
+	path string
+	err  error
+}
+
+// actorThumbs remembers the headshots fetched this run, keyed by URL, so an
+// actor appearing in many movies is downloaded once and copied after that
+var actorThumbs sync.Map
+
+// downloadActorThumbs saves the headshots of info's actors as
+// <dir>/.actors/<Actor Name>.jpg and returns the actors it has one for,
+// mapped to the path relative to dir. Failed downloads are logged and left out.
+func downloadActorThumbs(ctx context.Context, f *fetcher, info MovieInfo, dir string) map[string]string {
+	local := make(map[string]string)
+	for _, actor := range info.Actors {
+		url := info.ActorThumbs[actor]
+		if url == "" {
+			continue
+		}
+		rel := filepath.Join(actorDir, sanitizePath(actor, ".jpg"))
+		path := filepath.Join(dir, rel)
+		if _, err := os.Stat(path); err == nil {
+			local[actor] = filepath.ToSlash(rel)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			slog.Warn("Error creating actor folder", "dir", filepath.Dir(path), "err", err)
+			return local
+		}
+
+		entry, _ := actorThumbs.LoadOrStore(url, &actorThumb{})
+		thumb := entry.(*actorThumb)
+		thumb.mu.Lock()
+		downloaded := false
+		var err error
+		if thumb.done {
+			err = thumb.err
+		} else {
+			downloaded = true
+			err = downloadImage(ctx, f, url, path)
+			// A download cut off by this movie's context is tried again by
+			// the next one
+			if err == nil || ctx.Err() == nil {
+				thumb.done, thumb.path, thumb.err = true, path, err
+			}
+		}
+		src := thumb.path
+		thumb.mu.Unlock()
+		if err == nil && !downloaded {
+			err = copyFile(ctx, src, path)
+		}
+		if err != nil {
+			slog.Warn("Error downloading actor thumb", "actor", actor, "err", err)
+			continue
+		}
+		local[actor] = filepath.ToSlash(rel)
+	}
+	return local
+}
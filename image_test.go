@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDownloadActorThumbsRetriesAfterCancel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("\xff\xd8\xff\xe0 not much of a jpeg"))
+	}))
+	defer srv.Close()
+	f := &fetcher{client: srv.Client()}
+	info := MovieInfo{
+		Actors:      []string{"Actor One"},
+		ActorThumbs: map[string]string{"Actor One": srv.URL + "/retry-after-cancel.jpg"},
+	}
+
+	// The first movie's context is gone before the download
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if local := downloadActorThumbs(ctx, f, info, t.TempDir()); len(local) != 0 {
+		t.Fatalf("downloadActorThumbs with a cancelled context = %v, want nothing", local)
+	}
+
+	dir := t.TempDir()
+	local := downloadActorThumbs(context.Background(), f, info, dir)
+	if local["Actor One"] == "" {
+		t.Fatalf("downloadActorThumbs after a cancelled one = %v, want the thumb", local)
+	}
+	if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(local["Actor One"]))); err != nil {
+		t.Error(err)
+	}
+
+	// Later movies copy the first download
+	dir = t.TempDir()
+	if local := downloadActorThumbs(context.Background(), f, info, dir); local["Actor One"] == "" {
+		t.Errorf("downloadActorThumbs for a second movie = %v, want the thumb", local)
+	}
+}
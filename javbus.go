@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// javbusBaseURL is the javbus metadata site
+const javbusBaseURL = "https://www.javbus.com/"
+
+// javbusScraper reads javbus detail pages, found at <base>/<CODE>
+type javbusScraper struct {
+	// baseURL is javbusBaseURL, or a test server serving saved pages
+	baseURL string
+}
+
+func (s *javbusScraper) Name() string { return "javbus" }
+
+func (s *javbusScraper) Describe() sourceInfo {
+	return sourceInfo{
+		Site:  javbusBaseURL,
+		Codes: "label-number codes like ABC-123",
+		Auth:  "none, the age check cookie is sent automatically",
+	}
+}
+
+func (s *javbusScraper) Fetch(ctx context.Context, client *http.Client, code string) (MovieInfo, error) {
+	doc, pageURL, err := fetchDocument(ctx, client, s.baseURL+code)
+	if err != nil {
+		return MovieInfo{}, err
+	}
+	return parseJavbusPage(doc, code, pageURL), nil
+}
+
+// parseJavbusPage extracts the movie metadata from a javbus detail page
+func parseJavbusPage(doc *goquery.Document, code string, pageURL *url.URL) MovieInfo {
+	// Detail pages live at /<id>
+	info := MovieInfo{Code: code, SourceID: path.Base(pageURL.Path)}
+
+	title := strings.TrimSpace(doc.Find("div.container h3").First().Text())
+	info.Title = strings.TrimSpace(strings.TrimPrefix(title, code))
+
+	if href, ok := doc.Find("a.bigImage").Attr("href"); ok {
+		info.CoverURL = resolveURL(pageURL, href)
+		// The poster is the cropped thumbnail of the wide cover
+		// e.g. /pics/cover/abcd_b.jpg -> /pics/thumb/abcd.jpg
+		if strings.Contains(info.CoverURL, "/pics/cover/") {
+			poster := strings.Replace(info.CoverURL, "/pics/cover/", "/pics/thumb/", 1)
+			info.PosterURL = strings.Replace(poster, "_b.", ".", 1)
+		} else {
+			info.PosterURL = info.CoverURL
+		}
+	}
+
+	doc.Find("div.info p").Each(func(_ int, p *goquery.Selection) {
+		header := strings.TrimSpace(p.Find("span.header").Text())
+		switch header {
+		case "發行日期:":
+			info.ReleaseDate = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(p.Text()), header))
+		case "製作商:":
+			info.Studio = strings.TrimSpace(p.Find("a").Text())
+		}
+	})
+
+	doc.Find("div.info span.genre label a").Each(func(_ int, a *goquery.Selection) {
+		info.Genres = append(info.Genres, strings.TrimSpace(a.Text()))
+	})
+	doc.Find("div.info span.genre > a").Each(func(_ int, a *goquery.Selection) {
+		info.Actors = append(info.Actors, strings.TrimSpace(a.Text()))
+	})
+	doc.Find("#star-div a.avatar-box img").Each(func(_ int, img *goquery.Selection) {
+		name, _ := img.Attr("title")
+		src, ok := img.Attr("src")
+		// nowprinting.gif stands in for actors without a picture
+		if name == "" || !ok || strings.Contains(src, "nowprinting") {
+			return
+		}
+		if info.ActorThumbs == nil {
+			info.ActorThumbs = make(map[string]string)
+		}
+		info.ActorThumbs[strings.TrimSpace(name)] = resolveURL(pageURL, src)
+	})
+	// The sample boxes link to the full-size screenshots
+	doc.Find("#sample-waterfall a.sample-box").Each(func(_ int, a *goquery.Selection) {
+		if href, ok := a.Attr("href"); ok {
+			info.SampleImages = append(info.SampleImages, resolveURL(pageURL, href))
+		}
+	})
+	info.TrailerURL = findTrailer(doc, pageURL)
+
+	return info
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// consoleOut receives the banner, console logs and prompts. With -output
+// json it is stderr, leaving stdout to the JSON results.
+var consoleOut io.Writer = os.Stdout
+
+// setupLogging installs the default logger from cfg: a human-readable
+// console handler, teed to LogFile when one is configured. The returned
+// function closes the log file.
+func setupLogging(cfg Config) (func(), error) {
+	var level slog.Level
+	if cfg.LogLevel != "" {
+		if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+			return nil, fmt.Errorf("invalid log level %q (use debug, info, warn or error)", cfg.LogLevel)
+		}
+	}
+
+	var handler slog.Handler = newConsoleHandler(consoleOut, level)
+	closeLog := func() {}
+	if cfg.LogFile != "" {
+		f, err := os.OpenFile(cfg.LogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("error opening log file: %v", err)
+		}
+		fileHandler := slog.NewTextHandler(f, &slog.HandlerOptions{Level: level})
+		handler = teeHandler{handler, fileHandler}
+		closeLog = func() { f.Close() }
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return closeLog, nil
+}
+
+// consoleHandler prints records as "message key=value ...", prefixing
+// warnings and errors with their level
+type consoleHandler struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	level  slog.Leveler
+	attrs  []slog.Attr
+	prefix string
+	color  bool
+}
+
+func newConsoleHandler(w io.Writer, level slog.Leveler) *consoleHandler {
+	return &consoleHandler{mu: &consoleMu, w: w, level: level, color: colorOutput && w == consoleOut}
+}
+
+func (h *consoleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *consoleHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	if r.Level >= slog.LevelWarn {
+		b.WriteString(r.Level.String())
+		b.WriteString(": ")
+	}
+	b.WriteString(r.Message)
+
+	writeAttr := func(a slog.Attr) bool {
+		if a.Equal(slog.Attr{}) {
+			return true
+		}
+		b.WriteString(" ")
+		b.WriteString(h.prefix + a.Key)
+		b.WriteString("=")
+		b.WriteString(formatConsoleValue(a.Value.Resolve()))
+		return true
+	}
+	for _, a := range h.attrs {
+		writeAttr(a)
+	}
+	r.Attrs(writeAttr)
+	line := b.String()
+	if h.color {
+		line = colorize(r.Level, r.Message, line)
+	}
+	line += "\n"
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// Print above the progress bar and draw it again below
+	if p := activeProgress.Load(); p != nil && p.tty && p.w == h.w {
+		_, err := io.WriteString(h.w, "\r\033[K"+line+p.redraw())
+		return err
+	}
+	_, err := io.WriteString(h.w, line)
+	return err
+}
+
+func (h *consoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.attrs = append(clone.attrs[:len(clone.attrs):len(clone.attrs)], attrs...)
+	return &clone
+}
+
+func (h *consoleHandler) WithGroup(name string) slog.Handler {
+	clone := *h
+	clone.prefix += name + "."
+	return &clone
+}
+
+// formatConsoleValue prints values as-is so multi-line errors stay readable;
+// the log file handler is the one meant for parsing
+func formatConsoleValue(v slog.Value) string {
+	s := v.String()
+	if s == "" {
+		return `""`
+	}
+	return s
+}
+
+// teeHandler sends every record to all of its handlers
+type teeHandler []slog.Handler
+
+func (t teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range t {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	var firstErr error
+	for _, h := range t {
+		if !h.Enabled(ctx, r.Level) {
+			continue
+		}
+		if err := h.Handle(ctx, r.Clone()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (t teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(teeHandler, len(t))
+	for i, h := range t {
+		handlers[i] = h.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (t teeHandler) WithGroup(name string) slog.Handler {
+	handlers := make(teeHandler, len(t))
+	for i, h := range t {
+		handlers[i] = h.WithGroup(name)
+	}
+	return handlers
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// runLookup scrapes code and prints what the sources return, without
+// touching any files. The code goes through the normal extraction first so
+// the lookup also shows how a file name would be read.
+func runLookup(ctx context.Context, f *fetcher, w io.Writer, code string, cfg Config, asJSON bool) error {
+	code, _ = normalizeLookupCode(code, cfg)
+	info, err := scrapeMovie(ctx, f, code, cfg)
+	if err != nil {
+		return err
+	}
+	info = enrichInfo(info, code, cfg)
+
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(info)
+	}
+	printMovieInfo(w, info)
+	return nil
+}
+
+// normalizeLookupCode reads a code typed by the user like a file name,
+// splitting off the subtitle marker
+func normalizeLookupCode(code string, cfg Config) (string, bool) {
+	if found := findMovieCode(code, cfg); found != "" {
+		code = found
+	} else {
+		code = strings.ToUpper(strings.TrimSpace(code))
+	}
+	return splitSubtitleMarker(code)
+}
+
+// printMovieInfo writes info as aligned "Field: value" lines
+func printMovieInfo(w io.Writer, info MovieInfo) {
+	fields := []struct{ name, value string }{
+		{"Code", info.Code},
+		{"Title", info.Title},
+		{"Released", info.ReleaseDate},
+		{"Studio", info.Studio},
+		{"Actors", strings.Join(info.Actors, ", ")},
+		{"Genres", strings.Join(info.Genres, ", ")},
+		{"Set", info.Set},
+		{"Cover", info.CoverURL},
+		{"Poster", info.PosterURL},
+	}
+	for _, field := range fields {
+		fmt.Fprintf(w, "%-9s %s\n", field.name+":", field.value)
+	}
+}
@@ -1,34 +1,237 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sync/errgroup"
 )
 
 // Config struct definition
 type Config struct {
-	FilePath   string   `json:"file_path"`
-	VideoTypes []string `json:"video_types"`
-	ProxyAddr  string   `json:"proxy_addr"`
+	// Version is the config schema version, see currentConfigVersion
+	Version   int      `json:"version" yaml:"version" toml:"version"`
+	FilePath  string   `json:"file_path" yaml:"file_path" toml:"file_path"`
+	FilePaths []string `json:"file_paths,omitempty" yaml:"file_paths,omitempty" toml:"file_paths,omitempty"`
+	// VideoTypes are the extensions of the files to process, each with its
+	// leading dot, e.g. ".mp4". Case doesn't matter.
+	VideoTypes []string `json:"video_types" yaml:"video_types" toml:"video_types"`
+	ProxyAddr  string   `json:"proxy_addr" yaml:"proxy_addr" toml:"proxy_addr"`
+	// ProxyMap maps a host prefix to the proxy for requests to matching
+	// hosts, overriding ProxyAddr. The longest prefix wins and "direct"
+	// means no proxy. Mapped hosts are pinned to their proxy, ProxyList
+	// isn't tried when they block it.
+	ProxyMap map[string]string `json:"proxy_map,omitempty" yaml:"proxy_map,omitempty" toml:"proxy_map,omitempty"`
+	// ProxyList are more proxies to try, after ProxyAddr, when a site answers
+	// with a 403 or a block page
+	ProxyList   []string `json:"proxy_list,omitempty" yaml:"proxy_list,omitempty" toml:"proxy_list,omitempty"`
+	LogLevel    string   `json:"log_level" yaml:"log_level" toml:"log_level"`
+	LogFile     string   `json:"log_file" yaml:"log_file" toml:"log_file"`
+	DryRun      bool     `json:"dry_run" yaml:"dry_run" toml:"dry_run"`
+	Force       bool     `json:"-" yaml:"-" toml:"-"`
+	Interactive bool     `json:"-" yaml:"-" toml:"-"`
+	Quiet       bool     `json:"-" yaml:"-" toml:"-"`
+	FolderMode  bool     `json:"folder_mode" yaml:"folder_mode" toml:"folder_mode"`
+	// CodePatterns are tried in order after the built-in FC2/date formats;
+	// the first capture group of the first match is the code
+	CodePatterns []string `json:"code_patterns" yaml:"code_patterns" toml:"code_patterns"`
+	// Concurrency is the number of files processed in parallel. Files are
+	// started in path order and reported in it; name collisions only resolve
+	// the same way on every run with a Concurrency of 1.
+	Concurrency int `json:"concurrency" yaml:"concurrency" toml:"concurrency"`
+	// RequestsPerSecond caps scrape/download requests across all workers, 0 means unlimited
+	RequestsPerSecond float64 `json:"requests_per_second" yaml:"requests_per_second" toml:"requests_per_second"`
+	// MaxDownloadKBps caps the combined speed of image downloads, 0 means unlimited
+	MaxDownloadKBps int `json:"max_download_kbps" yaml:"max_download_kbps" toml:"max_download_kbps"`
+	// MaxRetries is how often a failed request is retried, at most maxRetriesLimit
+	MaxRetries int `json:"max_retries" yaml:"max_retries" toml:"max_retries"`
+	// Timeout is how many seconds one HTTP request may take, 0 means defaultTimeout
+	Timeout int `json:"timeout" yaml:"timeout" toml:"timeout"`
+	// MaxIdleConns is how many idle connections the HTTP client keeps open
+	// for reuse, per host and in total, 0 means defaultMaxIdleConns
+	MaxIdleConns int `json:"max_idle_conns,omitempty" yaml:"max_idle_conns,omitempty" toml:"max_idle_conns,omitempty"`
+	// RunTimeout is how many seconds the whole run may take, 0 means no limit
+	RunTimeout int `json:"run_timeout" yaml:"run_timeout" toml:"run_timeout"`
+	// ConfirmThreshold is how many files a run may rename before asking
+	// for confirmation, see -assume-yes; 0 never asks
+	ConfirmThreshold int `json:"confirm_threshold" yaml:"confirm_threshold" toml:"confirm_threshold"`
+	// PerFileTimeout is how many seconds one file may take, 0 means no
+	// limit. A file running over is abandoned and counted as failed.
+	PerFileTimeout int `json:"per_file_timeout,omitempty" yaml:"per_file_timeout,omitempty" toml:"per_file_timeout,omitempty"`
+	// UserAgent is sent with every request, empty means defaultUserAgent
+	UserAgent string `json:"user_agent" yaml:"user_agent" toml:"user_agent"`
+	// CacheDB is an SQLite file caching scraped metadata, empty disables it.
+	// CacheDir keeps the raw HTML of scraped pages, for parsing them again
+	// without fetching. Entries of both older than CacheTTLHours are fetched
+	// again, 0 keeps them forever.
+	CacheDB       string `json:"cache_db,omitempty" yaml:"cache_db,omitempty" toml:"cache_db,omitempty"`
+	CacheDir      string `json:"cache_dir,omitempty" yaml:"cache_dir,omitempty" toml:"cache_dir,omitempty"`
+	CacheTTLHours int    `json:"cache_ttl_hours,omitempty" yaml:"cache_ttl_hours,omitempty" toml:"cache_ttl_hours,omitempty"`
+	// NoCache is set by -no-cache: CacheDir is neither read nor written
+	NoCache bool `json:"-" yaml:"-" toml:"-"`
+	// GenreMap translates scraped genres, e.g. from Japanese to English,
+	// before they are used; mapping one to "" drops it. GenreMapFile holds
+	// more as a JSON object, entries in GenreMap win.
+	GenreMap     map[string]string `json:"genre_map,omitempty" yaml:"genre_map,omitempty" toml:"genre_map,omitempty"`
+	GenreMapFile string            `json:"genre_map_file,omitempty" yaml:"genre_map_file,omitempty" toml:"genre_map_file,omitempty"`
+	// ActorAliases map other spellings of an actor's name to the one to use
+	// in folders and nfo files, matched ignoring case and extra spaces.
+	// ActorAliasesFile holds more as a JSON object, entries in ActorAliases win.
+	ActorAliases     map[string]string `json:"actor_aliases,omitempty" yaml:"actor_aliases,omitempty" toml:"actor_aliases,omitempty"`
+	ActorAliasesFile string            `json:"actor_aliases_file,omitempty" yaml:"actor_aliases_file,omitempty" toml:"actor_aliases_file,omitempty"`
+	// SeriesMap maps a code prefix to the collection its movies belong to,
+	// written as <set> in the nfo, e.g. "ABW": "Series Name"
+	SeriesMap map[string]string `json:"series_map,omitempty" yaml:"series_map,omitempty" toml:"series_map,omitempty"`
+	// StudioMap maps a code prefix to its studio, e.g. "SSIS": "S1", for
+	// movies the source gave no studio, offline runs included
+	StudioMap map[string]string `json:"studio_map,omitempty" yaml:"studio_map,omitempty" toml:"studio_map,omitempty"`
+	// Cookies are sent to a source site, keyed by source name with the value
+	// in Cookie header form ("name=value; name2=value2"). CookieFile is a
+	// Netscape cookies.txt; only its cookies for source hosts are used.
+	Cookies    map[string]string `json:"cookies,omitempty" yaml:"cookies,omitempty" toml:"cookies,omitempty"`
+	CookieFile string            `json:"cookie_file,omitempty" yaml:"cookie_file,omitempty" toml:"cookie_file,omitempty"`
+	// Sources are the metadata sites tried in order, see scrapers
+	Sources []string `json:"sources" yaml:"sources" toml:"sources"`
+	// SubtitleTypes are renamed along with the video they belong to
+	SubtitleTypes []string `json:"subtitle_types" yaml:"subtitle_types" toml:"subtitle_types"`
+	// OrganizeBy groups folder mode movies under <root>/<field>/<CODE>/,
+	// field being one of actor, studio, year, genre or prefix. prefix buckets
+	// by the code's label, e.g. ABC/ABC-123/, or by its first
+	// OrganizePrefixLen characters, e.g. A/ABC-123/ for 1.
+	OrganizeBy        string `json:"organize_by" yaml:"organize_by" toml:"organize_by"`
+	OrganizePrefixLen int    `json:"organize_prefix_len,omitempty" yaml:"organize_prefix_len,omitempty" toml:"organize_prefix_len,omitempty"`
+	// KeepResolution appends a resolution tag found in the filename, e.g. ABC-123-1080p
+	KeepResolution bool `json:"keep_resolution" yaml:"keep_resolution" toml:"keep_resolution"`
+	// CodeCase is how codes are written in file and folder names: upper
+	// (the default), lower, or original to keep the file's own spelling
+	CodeCase string `json:"code_case,omitempty" yaml:"code_case,omitempty" toml:"code_case,omitempty"`
+	// PadNumbers zero-pads the number of letter-number codes to this many
+	// digits, e.g. 3 turns ABC-7 into ABC-007; 0 leaves numbers as they are
+	PadNumbers int `json:"pad_numbers" yaml:"pad_numbers" toml:"pad_numbers"`
+	// FFprobePath is the ffprobe binary used to rank duplicates by quality
+	FFprobePath string `json:"ffprobe_path" yaml:"ffprobe_path" toml:"ffprobe_path"`
+	// ActorThumbs downloads actor headshots into .actors/ next to the video
+	ActorThumbs bool `json:"actor_thumbs" yaml:"actor_thumbs" toml:"actor_thumbs"`
+	// DownloadSamples saves the sample screenshots into extrafanart/. It
+	// needs FolderMode, movies sharing a folder would share the samples too.
+	DownloadSamples bool `json:"download_samples" yaml:"download_samples" toml:"download_samples"`
+	// LocalArtDir holds posters named <CODE>.jpg that are copied in instead
+	// of downloading the poster
+	LocalArtDir string `json:"local_art_dir,omitempty" yaml:"local_art_dir,omitempty" toml:"local_art_dir,omitempty"`
+	// DownloadTrailer saves the preview video, when the source has one, as
+	// <video>-trailer.mp4
+	DownloadTrailer bool `json:"download_trailer,omitempty" yaml:"download_trailer,omitempty" toml:"download_trailer,omitempty"`
+	// NFOFormat is the media server the nfo files and artwork names are
+	// written for: kodi (the default), jellyfin or emby
+	NFOFormat string `json:"nfo_format,omitempty" yaml:"nfo_format,omitempty" toml:"nfo_format,omitempty"`
+	// SetMTime sets the modification time of the video, and of its folder in
+	// folder mode, to the release date
+	SetMTime bool `json:"set_mtime" yaml:"set_mtime" toml:"set_mtime"`
+	// ContainerTags writes the scraped title, date and genres into mp4
+	// files with the FFmpegPath binary
+	ContainerTags bool   `json:"container_tags" yaml:"container_tags" toml:"container_tags"`
+	FFmpegPath    string `json:"ffmpeg_path" yaml:"ffmpeg_path" toml:"ffmpeg_path"`
+	// NameTemplate is a text/template for the new file name, see nameData
+	NameTemplate string `json:"name_template" yaml:"name_template" toml:"name_template"`
+	// OutputDir receives the renamed files instead of their source
+	// directory. CopyMode copies them there and leaves the sources alone.
+	OutputDir string `json:"output_dir,omitempty" yaml:"output_dir,omitempty" toml:"output_dir,omitempty"`
+	CopyMode  bool   `json:"copy_mode,omitempty" yaml:"copy_mode,omitempty" toml:"copy_mode,omitempty"`
+	// LinkMode is how a file gets to its new path: move, copy, hardlink or
+	// symlink, see linkModes. Empty means move, or copy with CopyMode.
+	LinkMode string `json:"link_mode,omitempty" yaml:"link_mode,omitempty" toml:"link_mode,omitempty"`
+	// CollisionPolicy is what happens when the new name is taken: suffix
+	// (the default) appends _1, trash moves the existing file into .trash/
+	// next to it first, and skip leaves the source alone
+	CollisionPolicy string `json:"collision_policy,omitempty" yaml:"collision_policy,omitempty" toml:"collision_policy,omitempty"`
+	// CollisionFormat builds the suffix of the suffix policy from a counter,
+	// e.g. " (%d)" or ".%d"; empty means defaultCollisionFormat
+	CollisionFormat string `json:"collision_format,omitempty" yaml:"collision_format,omitempty" toml:"collision_format,omitempty"`
+	// ExcludePatterns skip matching files and directories during the walk,
+	// as globs or as regexes prefixed with "re:"
+	ExcludePatterns []string `json:"exclude_patterns" yaml:"exclude_patterns" toml:"exclude_patterns"`
+	// SkipHidden leaves dotfiles and folders, macOS ._ files included, and
+	// junkNames out of the walk and the watcher, whatever their extension
+	SkipHidden bool `json:"skip_hidden" yaml:"skip_hidden" toml:"skip_hidden"`
+	// MaxDepth stops the walk from entering directories more than that many
+	// levels below each root, 0 means unlimited
+	MaxDepth int `json:"max_depth,omitempty" yaml:"max_depth,omitempty" toml:"max_depth,omitempty"`
+	// IncludeGlobs, when not empty, limit the walk to video files whose name
+	// matches at least one of them, e.g. "*1080p*"
+	IncludeGlobs []string `json:"include_globs,omitempty" yaml:"include_globs,omitempty" toml:"include_globs,omitempty"`
+	// MinSizeMB skips smaller files such as samples and MaxSizeMB larger
+	// ones, 0 means no bound
+	MinSizeMB int64 `json:"min_size_mb" yaml:"min_size_mb" toml:"min_size_mb"`
+	MaxSizeMB int64 `json:"max_size_mb,omitempty" yaml:"max_size_mb,omitempty" toml:"max_size_mb,omitempty"`
+	// NotifyWebhook is a URL the run summary is posted to as JSON when the
+	// run ends, e.g. a Discord webhook. NotifyOnlyOnError skips clean runs.
+	NotifyWebhook     string `json:"notify_webhook,omitempty" yaml:"notify_webhook,omitempty" toml:"notify_webhook,omitempty"`
+	NotifyOnlyOnError bool   `json:"notify_only_on_error,omitempty" yaml:"notify_only_on_error,omitempty" toml:"notify_only_on_error,omitempty"`
+	// Manifest writes manifest.json after the run, listing every processed
+	// file with its status and size. ManifestHash adds SHA-256 checksums,
+	// which means reading every file in full.
+	Manifest     bool `json:"manifest,omitempty" yaml:"manifest,omitempty" toml:"manifest,omitempty"`
+	ManifestHash bool `json:"manifest_hash,omitempty" yaml:"manifest_hash,omitempty" toml:"manifest_hash,omitempty"`
+	// Overrides map a file name, or "re:" + a regex on it, to the code to use
+	// verbatim instead of extracting one. A key can also be the file's path,
+	// relative or absolute, which wins over its name. OverridesFile holds more of them
+	// as a JSON object; entries in Overrides win.
+	Overrides     map[string]string `json:"overrides,omitempty" yaml:"overrides,omitempty" toml:"overrides,omitempty"`
+	OverridesFile string            `json:"overrides_file,omitempty" yaml:"overrides_file,omitempty" toml:"overrides_file,omitempty"`
 }
 
 // New function to handle config loading
 func loadConfig(configFile string) (Config, error) {
 	// Default config values
 	defaultConfig := Config{
-		FilePath:   "./",
-		VideoTypes: []string{".mp4", ".mkv", ".avi"},
-		ProxyAddr:  "",
+		Version:          currentConfigVersion,
+		FilePath:         "./",
+		VideoTypes:       defaultVideoTypes,
+		ProxyAddr:        "",
+		LogLevel:         "info",
+		LogFile:          "",
+		FolderMode:       false,
+		CodePatterns:     defaultCodePatterns,
+		Concurrency:      defaultConcurrency,
+		MaxRetries:       3,
+		Timeout:          int(defaultTimeout / time.Second),
+		UserAgent:        defaultUserAgent,
+		Sources:          defaultSources,
+		SubtitleTypes:    defaultSubtitleTypes,
+		OrganizeBy:       "",
+		KeepResolution:   false,
+		CodeCase:         "upper",
+		FFprobePath:      "ffprobe",
+		FFmpegPath:       "ffmpeg",
+		NameTemplate:     defaultNameTemplate,
+		ActorThumbs:      true,
+		ExcludePatterns:  []string{"sample", "*-trailer.*"},
+		SkipHidden:       true,
+		ConfirmThreshold: defaultConfirmThreshold,
+		MinSizeMB:        50,
 	}
 
 	configData, err := os.ReadFile(configFile)
 	if err != nil {
 		// Config file doesn't exist, create one with default values
-		configData, err = json.MarshalIndent(defaultConfig, "", "    ")
+		configData, err = marshalConfig(defaultConfig, configFormat(configFile))
 		if err != nil {
 			return Config{}, fmt.Errorf("error creating default config: %v", err)
 		}
@@ -38,42 +241,685 @@ func loadConfig(configFile string) (Config, error) {
 			return Config{}, fmt.Errorf("error writing config file: %v", err)
 		}
 
-		fmt.Println("Created new config file with default values")
+		slog.Info("Created new config file with default values", "file", configFile)
 		return defaultConfig, nil
 	}
 
 	// Parse existing config file
 	var config Config
-	err = json.Unmarshal(configData, &config)
+	err = unmarshalConfig(configData, configFormat(configFile), &config)
 	if err != nil {
 		return Config{}, fmt.Errorf("error parsing config file: %v", err)
 	}
-	fmt.Println("Loaded existing config file")
+	slog.Info("Loaded existing config file", "file", configFile)
+
+	if config.Version < currentConfigVersion {
+		return migrateConfig(configFile, configData, defaultConfig)
+	}
 	return config, nil
 }
 
-// extractMovieCode extracts the movie code from filename
-func extractMovieCode(filename string) string {
+// currentConfigVersion is bumped whenever new config fields get defaults
+// that older config files should pick up
+const currentConfigVersion = 3
+
+// migrateConfig upgrades an older config file: the settings in configData
+// are applied on top of defaultConfig so fields the file doesn't have get
+// their default, and the result is written back with the current version.
+// The original is kept as <file>.bak.
+func migrateConfig(configFile string, configData []byte, defaultConfig Config) (Config, error) {
+	format := configFormat(configFile)
+	config := defaultConfig
+	config.Version = 0
+	if err := unmarshalConfig(configData, format, &config); err != nil {
+		return Config{}, fmt.Errorf("error parsing config file: %v", err)
+	}
+	oldVersion := config.Version
+	config.Version = currentConfigVersion
+
+	newData, err := marshalConfig(config, format)
+	if err != nil {
+		return Config{}, fmt.Errorf("error encoding config: %v", err)
+	}
+	if err := os.WriteFile(configFile+".bak", configData, 0644); err != nil {
+		return Config{}, fmt.Errorf("error backing up config file: %v", err)
+	}
+	if err := os.WriteFile(configFile, newData, 0644); err != nil {
+		return Config{}, fmt.Errorf("error writing config file: %v", err)
+	}
+	slog.Info("Migrated config file", "file", configFile, "from", oldVersion, "to", currentConfigVersion, "backup", configFile+".bak")
+	return config, nil
+}
+
+// validateConfig checks cfg for mistakes, reporting all of them at once.
+// VideoTypes and SubtitleTypes are normalized in place first.
+func validateConfig(cfg *Config) error {
+	var problems []string
+
+	cfg.VideoTypes = normalizeExtensions(cfg.VideoTypes)
+	cfg.SubtitleTypes = normalizeExtensions(cfg.SubtitleTypes)
+
+	dirs := sourceDirs(*cfg)
+	if len(dirs) == 0 {
+		problems = append(problems, "file_path is empty")
+	}
+	for _, dir := range dirs {
+		info, err := os.Stat(dir)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("file path %q does not exist", dir))
+		} else if !info.IsDir() && !info.Mode().IsRegular() {
+			problems = append(problems, fmt.Sprintf("file path %q is not a directory or file", dir))
+		}
+	}
+
+	if len(cfg.VideoTypes) == 0 {
+		problems = append(problems, "video_types is empty")
+	}
+	for _, ext := range cfg.VideoTypes {
+		if !strings.HasPrefix(ext, ".") {
+			problems = append(problems, fmt.Sprintf("video type %q must start with a dot", ext))
+		}
+	}
+	for _, ext := range cfg.SubtitleTypes {
+		if !strings.HasPrefix(ext, ".") {
+			problems = append(problems, fmt.Sprintf("subtitle type %q must start with a dot", ext))
+		}
+	}
+
+	if cfg.ProxyAddr != "" {
+		if u, err := url.Parse(cfg.ProxyAddr); err != nil || u.Scheme == "" || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("proxy_addr %q is not a valid URL", cfg.ProxyAddr))
+		}
+	}
+	for _, addr := range cfg.ProxyList {
+		if _, err := parseProxy(addr); err != nil {
+			problems = append(problems, fmt.Sprintf("proxy_list %q: %v", addr, err))
+		}
+	}
+	for prefix, addr := range cfg.ProxyMap {
+		if prefix == "" {
+			problems = append(problems, "proxy_map has an empty host prefix")
+		}
+		if addr == directProxy {
+			continue
+		}
+		if _, err := parseProxy(addr); err != nil {
+			problems = append(problems, fmt.Sprintf("proxy_map %q: %v", prefix, err))
+		}
+	}
+
+	for _, pattern := range cfg.CodePatterns {
+		if _, err := compilePattern(pattern); err != nil {
+			problems = append(problems, fmt.Sprintf("code pattern %q is invalid: %v", pattern, err))
+		}
+	}
+
+	if cfg.RequestsPerSecond < 0 {
+		problems = append(problems, "requests_per_second must not be negative")
+	}
+	if cfg.MaxDownloadKBps < 0 {
+		problems = append(problems, "max_download_kbps must not be negative")
+	}
+	if cfg.MaxRetries < 0 || cfg.MaxRetries > maxRetriesLimit {
+		problems = append(problems, fmt.Sprintf("max_retries must be between 0 and %d", maxRetriesLimit))
+	}
+	if cfg.CacheTTLHours < 0 {
+		problems = append(problems, "cache_ttl_hours must not be negative")
+	}
+	if cfg.PadNumbers < 0 {
+		problems = append(problems, "pad_numbers must not be negative")
+	}
+	if cfg.RunTimeout < 0 {
+		problems = append(problems, "run_timeout must not be negative")
+	}
+	if cfg.ConfirmThreshold < 0 {
+		problems = append(problems, "confirm_threshold must not be negative")
+	}
+	if cfg.PerFileTimeout < 0 {
+		problems = append(problems, "per_file_timeout must not be negative")
+	}
+	if cfg.Timeout < 0 {
+		problems = append(problems, "timeout must not be negative")
+	}
+	if cfg.MaxIdleConns < 0 {
+		problems = append(problems, "max_idle_conns must not be negative")
+	}
+	if cfg.OrganizeBy != "" && !slices.Contains(organizeFields, cfg.OrganizeBy) {
+		problems = append(problems, fmt.Sprintf("organize_by %q must be one of %s", cfg.OrganizeBy, strings.Join(organizeFields, ", ")))
+	}
+	if cfg.LocalArtDir != "" {
+		if info, err := os.Stat(cfg.LocalArtDir); err != nil || !info.IsDir() {
+			problems = append(problems, fmt.Sprintf("local_art_dir %q is not a directory", cfg.LocalArtDir))
+		}
+	}
+	if cfg.NotifyWebhook != "" {
+		if u, err := url.Parse(cfg.NotifyWebhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			problems = append(problems, fmt.Sprintf("notify_webhook %q must be an http(s) URL", cfg.NotifyWebhook))
+		}
+	}
+	if cfg.CodeCase != "" && !slices.Contains(codeCases, cfg.CodeCase) {
+		problems = append(problems, fmt.Sprintf("code_case %q must be one of %s", cfg.CodeCase, strings.Join(codeCases, ", ")))
+	}
+	if cfg.OrganizePrefixLen < 0 {
+		problems = append(problems, "organize_prefix_len must not be negative")
+	}
+	for _, source := range cfg.Sources {
+		if _, ok := scrapers[source]; !ok {
+			problems = append(problems, fmt.Sprintf("source %q is unknown", source))
+		}
+	}
+	for source, header := range cfg.Cookies {
+		if _, ok := sourceSites[source]; !ok {
+			problems = append(problems, fmt.Sprintf("cookies source %q is unknown", source))
+		} else if _, err := http.ParseCookie(header); err != nil {
+			problems = append(problems, fmt.Sprintf("cookies for %s are invalid: %v", source, err))
+		}
+	}
+
+	for _, pattern := range cfg.ExcludePatterns {
+		if err := validateExcludePattern(pattern); err != nil {
+			problems = append(problems, fmt.Sprintf("exclude pattern %q is invalid: %v", pattern, err))
+		}
+	}
+	for _, glob := range cfg.IncludeGlobs {
+		if _, err := filepath.Match(glob, ""); err != nil {
+			problems = append(problems, fmt.Sprintf("include glob %q is invalid: %v", glob, err))
+		}
+	}
+	if _, ok := nfoWriters[cfg.NFOFormat]; cfg.NFOFormat != "" && !ok {
+		problems = append(problems, fmt.Sprintf("nfo_format %q must be one of %s", cfg.NFOFormat, nfoFormats()))
+	}
+	if cfg.LinkMode != "" && !slices.Contains(linkModes, cfg.LinkMode) {
+		problems = append(problems, fmt.Sprintf("link_mode %q must be one of %s", cfg.LinkMode, strings.Join(linkModes, ", ")))
+	}
+	if cfg.CollisionPolicy != "" && !slices.Contains(collisionPolicies, cfg.CollisionPolicy) {
+		problems = append(problems, fmt.Sprintf("collision_policy %q must be one of %s", cfg.CollisionPolicy, strings.Join(collisionPolicies, ", ")))
+	}
+	if cfg.CollisionFormat != "" {
+		if err := validateCollisionFormat(cfg.CollisionFormat); err != nil {
+			problems = append(problems, fmt.Sprintf("collision_format %q %v", cfg.CollisionFormat, err))
+		}
+	}
+	if cfg.OutputDir != "" {
+		if info, err := os.Stat(cfg.OutputDir); err == nil && !info.IsDir() {
+			problems = append(problems, fmt.Sprintf("output_dir %q is not a directory", cfg.OutputDir))
+		}
+	}
+	if cfg.MinSizeMB < 0 {
+		problems = append(problems, "min_size_mb must not be negative")
+	}
+	if cfg.MaxDepth < 0 {
+		problems = append(problems, "max_depth must not be negative")
+	}
+	if cfg.MaxSizeMB < 0 {
+		problems = append(problems, "max_size_mb must not be negative")
+	} else if cfg.MaxSizeMB > 0 && cfg.MaxSizeMB < cfg.MinSizeMB {
+		problems = append(problems, "max_size_mb must not be below min_size_mb")
+	}
+	for key, code := range cfg.Overrides {
+		if err := validateOverride(key, code); err != nil {
+			problems = append(problems, fmt.Sprintf("override %q is invalid: %v", key, err))
+		}
+	}
+
+	if cfg.NameTemplate != "" {
+		// A dry render catches unknown variables as well as syntax errors
+		tmpl, err := compileNameTemplate(cfg.NameTemplate)
+		if err == nil {
+			err = tmpl.Execute(io.Discard, nameData{})
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("name_template is invalid: %v", err))
+		}
+	}
+
+	if cfg.LogLevel != "" {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+			problems = append(problems, fmt.Sprintf("log_level %q must be debug, info, warn or error", cfg.LogLevel))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid config:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// extractMovieCode extracts the movie code from filename. subtitled reports
+// whether the code carries the -C/-UC Chinese subtitle marker, which stays
+// in the returned name.
+func extractMovieCode(filename string, cfg Config) (name string, subtitled bool) {
 	// Remove path, keep only filename
 	base := filepath.Base(filename)
 
-	// Remove common prefixes/suffixes and URLs
-	// Common patterns: [XXX], (XXX), xxx-com, xxx.com
-	cleaned := regexp.MustCompile(`\[.*?\]|\(.*?\)|[-_](com|net|org|xyz)[^.]*`).ReplaceAllString(base, "")
-
-	// Extract movie code pattern (letters followed by numbers)
-	// Including optional -c or -uc suffix (case insensitive)
-	if matches := regexp.MustCompile(`(?i)([a-zA-Z]+-\d+(?:-(?:c|uc))?)`).FindString(cleaned); matches != "" {
+	if code := findFileCode(filename, cfg); code != "" {
+		_, subtitled = splitSubtitleMarker(code)
+		code = applyCodeCase(code, base, cfg)
 		// Get extension from original filename
 		ext := filepath.Ext(base)
-		return strings.ToUpper(matches) + ext
+		// Keep multi-part files apart, e.g. ABC-123-CD1, ABC-123-CD2. A
+		// subtitle marker after the part is already in code.
+		partName := strings.TrimSuffix(base, ext)
+		if subtitled {
+			partName, _ = splitSubtitleMarker(partName)
+		}
+		if part, ok := extractPart(partName); ok {
+			code += partSuffix(partName, part, cfg)
+		}
+		if cfg.KeepResolution {
+			res := extractResolution(strings.TrimSuffix(base, ext))
+			if res != "" && !strings.Contains(strings.ToUpper(code), strings.ToUpper(res)) {
+				code += "-" + res
+			}
+		}
+		return code + ext, subtitled
+	}
+
+	return base, false
+}
+
+// codeCases are the values accepted by Config.CodeCase
+var codeCases = []string{"upper", "lower", "original"}
+
+// applyCodeCase returns code, as found by findMovieCode, in the case
+// cfg.CodeCase asks for. "original" takes the spelling from name, the file
+// name code was found in; codes that were normalized on the way, such as
+// padded numbers, can't be found there and keep findMovieCode's case.
+func applyCodeCase(code, name string, cfg Config) string {
+	switch cfg.CodeCase {
+	case "lower":
+		return strings.ToLower(code)
+	case "original":
+		if i := strings.Index(strings.ToUpper(name), strings.ToUpper(code)); i >= 0 {
+			return name[i : i+len(code)]
+		}
+	}
+	return code
+}
+
+// partSuffix returns the -CD<part> suffix for the multi-part file name, in
+// the case cfg.CodeCase asks for. "original" follows the part marker in
+// name, cd1 and -a give -cd1, so a lowercase name stays lowercase.
+func partSuffix(name string, part int, cfg Config) string {
+	suffix := fmt.Sprintf("-CD%d", part)
+	switch cfg.CodeCase {
+	case "lower":
+		return strings.ToLower(suffix)
+	case "original":
+		marker := partPattern.FindString(name)
+		if marker == "" {
+			marker = partLetterPattern.FindString(name)
+		}
+		if marker != "" && marker == strings.ToLower(marker) {
+			return strings.ToLower(suffix)
+		}
+	}
+	return suffix
+}
+
+// subtitleMarkerPattern matches the Chinese subtitle marker at the end of a code
+var subtitleMarkerPattern = regexp.MustCompile(`(?i)-(?:c|uc)$`)
+
+// splitSubtitleMarker returns code without its -C/-UC marker, which is what
+// the sources know the movie by, and whether it had one
+func splitSubtitleMarker(code string) (string, bool) {
+	if loc := subtitleMarkerPattern.FindStringIndex(code); loc != nil {
+		return code[:loc[0]], true
+	}
+	return code, false
+}
+
+// resolutionPattern matches resolution tags such as 1080p, 4K or FHD
+var resolutionPattern = regexp.MustCompile(`(?i)(?:^|[^a-z0-9])(2160p|1080p|720p|4k|uhd|fhd)(?:[^a-z0-9]|$)`)
+
+// resolutionTags maps the recognized tags to their canonical form
+var resolutionTags = map[string]string{
+	"2160p": "4K",
+	"4k":    "4K",
+	"uhd":   "4K",
+	"1080p": "1080p",
+	"fhd":   "1080p",
+	"720p":  "720p",
+}
+
+// extractResolution returns the canonical resolution tag in name, or "" if there is none
+func extractResolution(name string) string {
+	if m := resolutionPattern.FindStringSubmatch(name); m != nil {
+		return resolutionTags[strings.ToLower(m[1])]
+	}
+	return ""
+}
+
+// partPattern matches cd1, pt1, part1 style part markers
+var partPattern = regexp.MustCompile(`(?i)(?:^|[-_ .\]])(?:cd|pt|part)[-_ ]?(\d{1,2})(?:[-_ .\[]|$)`)
+
+// partLetterPattern matches a trailing -A/-B part marker
+var partLetterPattern = regexp.MustCompile(`(?i)[-_ ]([ab])$`)
+
+// extractPart returns the part number of a multi-part file name (without extension)
+func extractPart(name string) (part int, ok bool) {
+	if m := partPattern.FindStringSubmatch(name); m != nil {
+		part, err := strconv.Atoi(m[1])
+		return part, err == nil && part > 0
+	}
+	if m := partLetterPattern.FindStringSubmatch(name); m != nil {
+		// ABC-123-A-B is no part B, the letters only mean something alone
+		if partLetterPattern.MatchString(name[:len(name)-len(m[0])]) {
+			return 0, false
+		}
+		return int(strings.ToLower(m[1])[0]-'a') + 1, true
+	}
+	return 0, false
+}
+
+// fc2Pattern matches the FC2-PPV family, e.g. FC2-PPV-1234567, fc2ppv-1234567
+var fc2Pattern = regexp.MustCompile(`(?i)fc2[-_ ]*ppv[-_ ]*(\d+)`)
+
+// matchFC2 returns the normalized FC2-PPV-<digits> code in name, or "" if there is none
+func matchFC2(name string) string {
+	if m := fc2Pattern.FindStringSubmatch(name); m != nil {
+		return "FC2-PPV-" + m[1]
+	}
+	return ""
+}
+
+// dateCodePattern matches uncensored date-based codes (1Pondo, Carib, 10musume),
+// e.g. 100119_001, 010120-123, 1pondo_100119_001
+var dateCodePattern = regexp.MustCompile(`(?:^|\D)(\d{6})[-_](\d{2,3})(?:\D|$)`)
+
+// dateCodeSeparator is used between the date and the number of normalized date codes
+const dateCodeSeparator = "_"
+
+// matchDateCode returns the normalized DDMMYY_NNN code in name, or "" if there is none
+func matchDateCode(name string) string {
+	if m := dateCodePattern.FindStringSubmatch(name); m != nil {
+		return m[1] + dateCodeSeparator + m[2]
+	}
+	return ""
+}
+
+// defaultCodePatterns matches letters followed by numbers, including an
+// optional -c or -uc suffix (case insensitive). The suffix must end the
+// token so that e.g. -cd1 isn't read as -c.
+var defaultCodePatterns = []string{`(?i)([a-zA-Z]+-\d+(?:-(?:c|uc))?)(?:[^a-zA-Z]|$)`}
+
+// patternCache holds compiled user-supplied patterns keyed by their source
+var patternCache sync.Map
+
+// compilePattern compiles pattern once and caches the result
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := patternCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patternCache.Store(pattern, re)
+	return re, nil
+}
+
+// cleanPattern matches common prefixes/suffixes and URLs
+// Common patterns: [XXX], (XXX), xxx-com, xxx.com
+var cleanPattern = regexp.MustCompile(`\[.*?\]|\(.*?\)|[-_](com|net|org|xyz)[^.]*`)
+
+// siteTagPattern matches site tags glued on with @, before or after the code:
+// hhd800.com@ABC-123 and ABC-123@somesite
+var siteTagPattern = regexp.MustCompile(`(?i)[a-z0-9.-]*\.[a-z]{2,4}@|@[a-z0-9.-]+`)
+
+// groupTagPattern matches a trailing release-group tag such as -UncleJack.
+// Tags of three letters or less are kept, that covers -C, -UC and -FHD, and
+// so is anything with digits, like n1234.
+var groupTagPattern = regexp.MustCompile(`[-_ ]([a-zA-Z]{4,})$`)
+
+// separatorNoisePattern matches runs of separators left over by the cleanup
+var separatorNoisePattern = regexp.MustCompile(`[-_ ]{2,}`)
+
+// stripTags removes site and release-group decoration around the code in a
+// file name, keeping the extension
+func stripTags(name string) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	base = siteTagPattern.ReplaceAllString(base, "")
+	if m := groupTagPattern.FindStringSubmatch(base); m != nil && !isKnownTag(m[1]) {
+		base = strings.TrimSuffix(base, m[0])
+	}
+	base = separatorNoisePattern.ReplaceAllStringFunc(base, func(run string) string {
+		return run[:1]
+	})
+	base = strings.Trim(base, "-_ ")
+	return base + ext
+}
+
+// isKnownTag reports whether tag means something to the rest of the
+// extractor and must survive stripTags
+func isKnownTag(tag string) bool {
+	if _, ok := resolutionTags[strings.ToLower(tag)]; ok {
+		return true
+	}
+	return partPattern.MatchString("-" + tag)
+}
+
+// findMovieCode returns the normalized movie code found in name, or "" if there is none
+func findMovieCode(name string, cfg Config) string {
+	code, _ := matchMovieCode(name, cfg)
+	return code
+}
+
+// findFileCode is findMovieCode for the video at path
+func findFileCode(path string, cfg Config) string {
+	code, _ := matchFileCode(path, cfg)
+	return code
+}
+
+// matchFileCode is matchMovieCode for the video at path: overrides keyed on
+// the path are tried before the base name, which the code is taken from
+func matchFileCode(path string, cfg Config) (code, rule string) {
+	if code, ok := overrideCode(path, cfg); ok {
+		return code, "override"
+	}
+	return matchMovieCode(filepath.Base(path), cfg)
+}
+
+// matchMovieCode is findMovieCode that also tells which rule matched: the
+// override, fc2, date, separated, dashless or tokyo-hot format, or the code
+// pattern
+func matchMovieCode(name string, cfg Config) (code, rule string) {
+	if code, ok := overrideCode(name, cfg); ok {
+		return code, "override"
+	}
+
+	cleaned := cleanPattern.ReplaceAllString(stripTags(name), "")
+
+	// Special formats are tried in a fixed order before the generic pattern
+	if code := matchFC2(cleaned); code != "" {
+		return code, "fc2"
+	}
+	if code := matchDateCode(cleaned); code != "" {
+		return code, "date"
 	}
 
-	return base
+	patterns := cfg.CodePatterns
+	if len(patterns) == 0 {
+		patterns = defaultCodePatterns
+	}
+	for _, pattern := range patterns {
+		re, err := compilePattern(pattern)
+		if err != nil {
+			// Invalid patterns are reported by validateConfig
+			continue
+		}
+		for _, matches := range re.FindAllStringSubmatch(cleaned, -1) {
+			code := matches[0]
+			for _, group := range matches[1:] {
+				if group != "" {
+					code = group
+					break
+				}
+			}
+			if m := codeLabelPattern.FindStringSubmatch(code); m != nil && notCode(m[1], m[2]) {
+				continue
+			}
+			return withPartSubtitle(padCodeNumber(strings.ToUpper(code), cfg.PadNumbers), cleaned), pattern
+		}
+	}
+
+	// Last, so a regular code elsewhere in the name wins
+	if code := matchSeparatedCode(cleaned); code != "" {
+		return withPartSubtitle(padCodeNumber(code, cfg.PadNumbers), cleaned), "separated"
+	}
+	if code := matchDashlessCode(cleaned); code != "" {
+		return withPartSubtitle(padCodeNumber(code, cfg.PadNumbers), cleaned), "dashless"
+	}
+	if code := matchTokyoHot(cleaned); code != "" {
+		return code, "tokyo-hot"
+	}
+	return "", ""
 }
 
-func getUniqueFilePath(targetPath string) string {
-	if _, err := os.Stat(targetPath); err != nil {
+// partSubtitlePattern matches a subtitle marker after the part marker at
+// the end of a name without extension, e.g. ABC-123-CD1-C or ABC-123-A-UC
+var partSubtitlePattern = regexp.MustCompile(`(?i)(?:(?:^|[-_ .\]])(?:cd|pt|part)[-_ ]?\d{1,2}|[-_ ][ab])(-(?:c|uc))$`)
+
+// withPartSubtitle adds the subtitle marker name puts after its part marker
+// to code, which the code patterns can't see past the part
+func withPartSubtitle(code, name string) string {
+	if _, ok := splitSubtitleMarker(code); ok {
+		return code
+	}
+	if m := partSubtitlePattern.FindStringSubmatch(strings.TrimSuffix(name, filepath.Ext(name))); m != nil {
+		return code + strings.ToUpper(m[1])
+	}
+	return code
+}
+
+// separatedCodePattern matches codes written with dots or spaces instead of
+// the dash, e.g. ABC.123 or ABC 123
+var separatedCodePattern = regexp.MustCompile(`(?i)(?:^|[^a-z0-9])([a-z]{2,5})[. ]+(\d{2,5})(-(?:c|uc))?(?:[^a-z0-9]|$)`)
+
+// dashlessCodePattern matches codes without any separator, e.g. SIRO12345
+var dashlessCodePattern = regexp.MustCompile(`(?i)(?:^|[^a-z0-9])([a-z]{2,6})(\d{3,5})(-(?:c|uc))?(?:[^a-z0-9]|$)`)
+
+// notCodeLabels are words, technical tokens and camera file prefixes that
+// look like a label in front of a number but aren't one, e.g. Part 12,
+// DVD 2020, HEVC265 or IMG_2023. Every rule but the override skips them.
+var notCodeLabels = map[string]bool{
+	"part": true, "pt": true, "cd": true, "disc": true, "disk": true,
+	"vol": true, "ep": true, "no": true, "dvd": true, "bd": true,
+	"hd": true, "fhd": true, "uhd": true, "hevc": true, "avc": true,
+	"aac": true, "ac": true, "dts": true, "ddp": true, "web": true,
+	"webdl": true, "bdrip": true, "mpeg": true, "divx": true, "xvid": true,
+	"img": true, "dsc": true, "dscn": true, "mvi": true, "pxl": true,
+	"vid": true, "mov": true,
+}
+
+// commonYearWords are ordinary words that, followed by a year, name home
+// videos rather than movies, e.g. Vacation.Video.2020
+var commonYearWords = map[string]bool{
+	"video": true, "movie": true, "clip": true, "film": true, "vacation": true,
+	"holiday": true, "trip": true, "family": true, "home": true, "wedding": true,
+	"party": true, "birthday": true, "summer": true, "winter": true, "spring": true,
+	"autumn": true, "year": true, "new": true, "best": true, "show": true,
+}
+
+// yearPattern matches a four-digit number that reads as a year
+var yearPattern = regexp.MustCompile(`^(?:19|20)\d{2}$`)
+
+// codeLabelPattern splits a code found by a code pattern into its label and
+// number, e.g. ABC-123
+var codeLabelPattern = regexp.MustCompile(`^([A-Za-z]+)[-_ .]?(\d+)`)
+
+// notCode reports whether label and number only look like a code: the label
+// is in notCodeLabels, or it is a common word followed by a year. Four-digit
+// numbers alone don't count, HEYZO-1234 is a real code.
+func notCode(label, number string) bool {
+	label = strings.ToLower(label)
+	return notCodeLabels[label] || (commonYearWords[label] && yearPattern.MatchString(number))
+}
+
+// matchSeparatedCode returns the dot or space separated code in name in
+// ABC-123 form, or "" if there is none
+func matchSeparatedCode(name string) string {
+	return matchLabelNumber(separatedCodePattern, name)
+}
+
+// matchDashlessCode returns the code without separator in name in
+// ABC-123 form, or "" if there is none
+func matchDashlessCode(name string) string {
+	return matchLabelNumber(dashlessCodePattern, name)
+}
+
+// matchLabelNumber returns the first label and number matched by re in name,
+// joined by a dash and followed by the subtitle marker if there is one,
+// skipping the ones notCode rejects
+func matchLabelNumber(re *regexp.Regexp, name string) string {
+	// Matches can share the separator, so every search starts right after
+	// the previous label instead of after the whole match
+	for start := 0; start < len(name); {
+		m := re.FindStringSubmatchIndex(name[start:])
+		if m == nil {
+			return ""
+		}
+		label, number := name[start+m[2]:start+m[3]], name[start+m[4]:start+m[5]]
+		if !notCode(label, number) {
+			var marker string
+			if m[6] >= 0 {
+				marker = name[start+m[6] : start+m[7]]
+			}
+			return strings.ToUpper(label + "-" + number + marker)
+		}
+		start += m[3]
+	}
+	return ""
+}
+
+// tokyoHotDecoration is the studio name often put in front of Tokyo-Hot codes
+var tokyoHotDecoration = regexp.MustCompile(`(?i)tokyo[-_ ]?hot`)
+
+// tokyoHotPattern matches Tokyo-Hot codes: n or k glued to four digits
+var tokyoHotPattern = regexp.MustCompile(`(?i)(?:^|[^a-z0-9])([nk])(\d{4})(?:[^a-z0-9]|$)`)
+
+// matchTokyoHot returns the lowercase n1234/k1234 code in name, or "" if there is none
+func matchTokyoHot(name string) string {
+	name = tokyoHotDecoration.ReplaceAllString(name, "")
+	if m := tokyoHotPattern.FindStringSubmatch(name); m != nil {
+		return strings.ToLower(m[1]) + m[2]
+	}
+	return ""
+}
+
+// codeNumberPattern finds the last digit group of a code, before any suffix like -C
+var codeNumberPattern = regexp.MustCompile(`(\d+)(\D*)$`)
+
+// padCodeNumber zero-pads the last digit group of code to width digits.
+// Numbers that are already as wide are kept as they are.
+func padCodeNumber(code string, width int) string {
+	if width <= 0 {
+		return code
+	}
+	m := codeNumberPattern.FindStringSubmatchIndex(code)
+	if m == nil {
+		return code
+	}
+	digits := code[m[2]:m[3]]
+	if len(digits) >= width {
+		return code
+	}
+	return code[:m[2]] + strings.Repeat("0", width-len(digits)) + digits + code[m[3]:]
+}
+
+// getUniqueFilePath returns targetPath, or when that is taken the first free
+// name with CollisionFormat, e.g. _%d, applied to a counter before the
+// extension. A name holding src itself, or its copy or link in those modes,
+// counts as free, so a rerun lands on the name the last run picked.
+func getUniqueFilePath(ctx context.Context, src, targetPath string, cfg Config) string {
+	format := cfg.CollisionFormat
+	if format == "" {
+		format = defaultCollisionFormat
+	}
+	if !pathTaken(ctx, src, targetPath, cfg) {
 		// 文件不存在，可以直接使用
 		return targetPath
 	}
@@ -84,8 +930,8 @@ func getUniqueFilePath(targetPath string) string {
 
 	counter := 1
 	for {
-		newPath := filepath.Join(dir, fmt.Sprintf("%s_%d%s", nameWithoutExt, counter, ext))
-		if _, err := os.Stat(newPath); err != nil {
+		newPath := filepath.Join(dir, nameWithoutExt+fmt.Sprintf(format, counter)+ext)
+		if !pathTaken(ctx, src, newPath, cfg) {
 			// 找到一个不存在的文件名
 			return newPath
 		}
@@ -93,59 +939,954 @@ func getUniqueFilePath(targetPath string) string {
 	}
 }
 
-func main() {
-	fmt.Println("ScrapeMovieData v0.0.0")
-	fmt.Println("hello world")
+// sourceDirs returns the directories to scan, merging FilePath and
+// FilePaths without duplicates. An entry can also be a single video file.
+func sourceDirs(cfg Config) []string {
+	var dirs []string
+	seen := make(map[string]bool)
+	for _, dir := range append([]string{cfg.FilePath}, cfg.FilePaths...) {
+		if dir == "" {
+			continue
+		}
+		clean := filepath.Clean(dir)
+		if seen[clean] {
+			continue
+		}
+		seen[clean] = true
+		dirs = append(dirs, clean)
+	}
+	return dirs
+}
 
-	// Load config
-	config, err := loadConfig("config.json")
+// targetPath returns the path file should be renamed to. info is the
+// scraped metadata, empty when scraping failed or was skipped.
+func targetPath(file string, cfg Config, info MovieInfo) string {
+	dir := filepath.Dir(file)
+	root := sourceRoot(file, cfg)
+	if cfg.OutputDir != "" {
+		dir, root = cfg.OutputDir, cfg.OutputDir
+	}
+	name := renderName(file, cfg, info)
+
+	code := findFileCode(file, cfg)
+	if !cfg.FolderMode || code == "" {
+		return filepath.Join(dir, name)
+	}
+	code = applyCodeCase(code, filepath.Base(file), cfg)
+
+	// In folder mode each movie gets its own <CODE>/ directory, grouped
+	// under <root>/<field>/ with OrganizeBy, unless it already sits in one
+	if cfg.OrganizeBy != "" && (info.Code != "" || !organizeNeedsMetadata(cfg.OrganizeBy)) {
+		dir = filepath.Join(root, organizeFolder(info, code, cfg), code)
+	} else if !strings.EqualFold(filepath.Base(dir), code) {
+		dir = filepath.Join(dir, code)
+	}
+
+	return filepath.Join(dir, name)
+}
+
+// defaultConcurrency is used when the config doesn't set Concurrency
+const defaultConcurrency = 4
+
+// defaultConfirmThreshold is the ConfirmThreshold of a new config file
+const defaultConfirmThreshold = 1000
+
+// renameMu makes picking a free target path and reserving it atomic across
+// workers, so two files can't claim the same name. The transfer onto a
+// reserved path runs outside the lock, a slow copy doesn't hold up the others.
+var renameMu sync.Mutex
+
+// reservedPaths are the targets of transfers in progress, taken as far as
+// getUniqueFilePath is concerned. Guarded by renameMu.
+var reservedPaths = make(map[string]bool)
+
+// transferTargets are all paths this run has transferred files to. The
+// watcher sees them appear like new files and leaves them alone. Guarded by
+// renameMu.
+var transferTargets = make(map[string]bool)
+
+// reservePath marks path as the target of a transfer in progress, and as
+// one of transferTargets. Callers hold renameMu.
+func reservePath(path string) {
+	reservedPaths[filepath.Clean(path)] = true
+	transferTargets[filepath.Clean(path)] = true
+}
+
+// isTransferTarget reports whether this run has transferred a file to path
+func isTransferTarget(path string) bool {
+	renameMu.Lock()
+	defer renameMu.Unlock()
+	return transferTargets[filepath.Clean(path)]
+}
+
+// releasePath drops the reservation of path once its transfer is done
+func releasePath(path string) {
+	renameMu.Lock()
+	defer renameMu.Unlock()
+	delete(reservedPaths, filepath.Clean(path))
+}
+
+// processFiles runs processFile over files with a bounded pool of workers.
+// The results are in the same order as files; failed files have Err set.
+// Cancelling ctx, or quitting an interactive run, stops handing out the
+// remaining files; the ones already started run to completion so no move
+// or download is cut off halfway.
+func processFiles(ctx context.Context, files []string, cfg Config, f *fetcher) []fileResult {
+	workers := cfg.Concurrency
+	if workers <= 0 {
+		workers = defaultConcurrency
+	}
+	// Prompts and their answers must not interleave
+	if cfg.Interactive {
+		workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Prompts would be garbled by the bar
+	var bar *progress
+	if !cfg.Quiet && !cfg.Interactive {
+		bar = startProgress(len(files))
+		defer bar.stop()
+	}
+
+	results := make([]fileResult, len(files))
+	jobs := make(chan int)
+	var g errgroup.Group
+	for i := 0; i < workers; i++ {
+		g.Go(func() error {
+			for i := range jobs {
+				fileCtx, cancelFile := fileContext(ctx, cfg)
+				result, err := processFile(fileCtx, files[i], cfg, f)
+				err = fileTimeoutErr(fileCtx, err)
+				cancelFile()
+				if errors.Is(err, errQuit) {
+					slog.Info("Quit, skipping the remaining files")
+					cancel()
+					continue
+				}
+				if err != nil {
+					slog.Error("Error processing", "file", files[i], "err", err)
+					result.Err = err
+				}
+				results[i] = result
+				if bar != nil {
+					bar.step()
+				}
+			}
+			return nil
+		})
+	}
+
+dispatch:
+	for i := range files {
+		// select picks randomly when a worker is free as well
+		if ctx.Err() != nil {
+			break
+		}
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	g.Wait()
+
+	// Files never reached after a quit have no result
+	done := results[:0]
+	for _, result := range results {
+		if result.File != "" {
+			done = append(done, result)
+		}
+	}
+	return done
+}
+
+// finishContext returns a context for a file that should be finished even
+// after ctx is cancelled, so no move or download is cut off halfway, but
+// that still ends at ctx's deadline
+func finishContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	fileCtx := context.WithoutCancel(ctx)
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(fileCtx, deadline)
+	}
+	return context.WithCancel(fileCtx)
+}
+
+// errFileTimeout is the cause of a file's context running over
+// PerFileTimeout
+var errFileTimeout = errors.New("per_file_timeout exceeded")
+
+// fileContext returns the context for processing one file: finishContext,
+// bounded by PerFileTimeout when that is set
+func fileContext(ctx context.Context, cfg Config) (context.Context, context.CancelFunc) {
+	fileCtx, cancelFinish := finishContext(ctx)
+	if cfg.PerFileTimeout <= 0 {
+		return fileCtx, cancelFinish
+	}
+	timeout := time.Duration(cfg.PerFileTimeout) * time.Second
+	fileCtx, cancelTimeout := context.WithTimeoutCause(fileCtx, timeout, errFileTimeout)
+	return fileCtx, func() {
+		cancelTimeout()
+		cancelFinish()
+	}
+}
+
+// stepContext bounds the work on one file outside processFile, such as
+// probing it for -fix or -dedup, by PerFileTimeout. Unlike fileContext it
+// ends with ctx, nothing is left halfway there.
+func stepContext(ctx context.Context, cfg Config) (context.Context, context.CancelFunc) {
+	if cfg.PerFileTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeoutCause(ctx, time.Duration(cfg.PerFileTimeout)*time.Second, errFileTimeout)
+}
+
+// fileTimeoutErr turns the result of a file whose context ran over
+// PerFileTimeout into errFileTimeout, whatever step it was stuck in
+func fileTimeoutErr(fileCtx context.Context, err error) error {
+	if err == nil && errors.Is(context.Cause(fileCtx), errFileTimeout) {
+		return errFileTimeout
+	}
+	return err
+}
+
+// fileAbandoned returns why processing a file must stop before it touches
+// the filesystem: errFileTimeout, or the run deadline's error once fileCtx
+// is done. A cancelled run doesn't end fileCtx, see finishContext.
+func fileAbandoned(fileCtx context.Context) error {
+	if fileCtx.Err() == nil {
+		return nil
+	}
+	return context.Cause(fileCtx)
+}
+
+// fileResult describes what processFile did with a video file
+type fileResult struct {
+	File    string // original path
+	NewPath string // final path, the same as File when nothing was renamed
+	Code    string // movie code, empty when none was found
+	Renamed bool
+	Info    MovieInfo // scraped metadata, empty when scraping failed or was skipped
+	Err     error     // set by processFiles when the file failed
+	// ScrapeErr is set when the file was renamed but its metadata couldn't
+	// be scraped or written
+	ScrapeErr error
+	// Collision is the new path when another file already had it
+	Collision string
+}
+
+// processFile renames file to its movie code and scrapes its metadata.
+// Only a failed rename is returned as an error; scrape failures keep the
+// renamed file and are just logged.
+func processFile(ctx context.Context, file string, cfg Config, f *fetcher) (fileResult, error) {
+	result := fileResult{File: file, NewPath: file}
+	if !isFileStable(ctx, file) {
+		slog.Warn("Skipped (still being written)", "file", file)
+		return result, nil
+	}
+	result.Code = findFileCode(file, cfg)
+	if _, ok := overrideCode(file, cfg); ok {
+		slog.Info("Using override", "file", file, "code", result.Code)
+	}
+
+	// Scrape first, OrganizeBy and the name template may need the metadata.
+	// Dry runs only scrape when they need it for that.
+	// The sources don't know the subtitle marker, look up the base code
+	var info MovieInfo
+	var scrapeErr error
+	lookupCode, subtitled := splitSubtitleMarker(result.Code)
+	if result.Code != "" && (!cfg.DryRun || nameNeedsMetadata(cfg)) {
+		info, scrapeErr = scrapeMovie(ctx, f, lookupCode, cfg)
+		info = enrichInfo(info, lookupCode, cfg)
+		info.Subtitled = subtitled
+	}
+	// A file stuck past its timeout is abandoned where it is
+	if err := fileAbandoned(ctx); err != nil {
+		return result, err
+	}
+
+	newPath := targetPath(file, cfg, info)
+
+	if file != newPath {
+		if cfg.Interactive {
+			ok, err := confirmPrompt.confirm(file, newPath)
+			if err != nil {
+				return result, err
+			}
+			if !ok {
+				slog.Info("Skipped", "file", file)
+				return result, nil
+			}
+		}
+		if !cfg.DryRun {
+			if err := os.MkdirAll(filepath.Dir(newPath), 0755); err != nil {
+				return result, fmt.Errorf("error creating folder: %v", err)
+			}
+		}
+		renameMu.Lock()
+		uniquePath, collided, err := resolveCollision(ctx, file, newPath, cfg)
+		if err != nil {
+			renameMu.Unlock()
+			if collided {
+				result.Collision = newPath
+			}
+			return result, err
+		}
+		switch {
+		case uniquePath == "":
+			renameMu.Unlock()
+			result.Collision = newPath
+			slog.Info("Skipped (target exists)", "file", file, "target", newPath)
+			return result, nil
+		case uniquePath == file:
+			// An earlier run already gave it the suffixed name
+			renameMu.Unlock()
+			slog.Info("Skipped (already named correctly)", "file", file)
+		case alreadyTransferred(ctx, file, uniquePath, cfg):
+			// The copy or link from an earlier run is still there
+			renameMu.Unlock()
+			result.NewPath = uniquePath
+			slog.Info("Skipped (already transferred)", "file", file, "to", uniquePath)
+		default:
+			if cfg.DryRun {
+				renameMu.Unlock()
+			} else {
+				// The prompt or a slow collision check may have used up the time
+				if err := fileAbandoned(ctx); err != nil {
+					renameMu.Unlock()
+					return result, err
+				}
+				reservePath(uniquePath)
+				renameMu.Unlock()
+				err := transferFile(ctx, file, uniquePath, cfg)
+				releasePath(uniquePath)
+				if err != nil {
+					return result, fmt.Errorf("error renaming to %s: %v", uniquePath, err)
+				}
+				recordUndo(file, uniquePath, cfg)
+			}
+			if collided {
+				result.Collision = newPath
+			}
+			result.Renamed = true
+			result.NewPath = uniquePath
+			displayPath, err := filepath.Rel(filepath.Dir(file), uniquePath)
+			if err != nil || cfg.OutputDir != "" {
+				displayPath = uniquePath
+			}
+			slog.Info("Renamed", "file", file, "to", displayPath)
+			renameSubtitles(ctx, file, uniquePath, cfg)
+		}
+	} else {
+		slog.Info("Skipped (already named correctly)", "file", file)
+	}
+
+	if result.Code == "" || cfg.DryRun {
+		return result, nil
+	}
+
+	// A failed scrape keeps the renamed file, it just gets no nfo
+	finalPath, code := result.NewPath, result.Code
+	if scrapeErr != nil {
+		slog.Warn("Error scraping", "file", finalPath, "code", code, "err", scrapeErr)
+		result.ScrapeErr = scrapeErr
+		return result, nil
+	}
+	result.Info = info
+	basePath := strings.TrimSuffix(finalPath, filepath.Ext(finalPath))
+	if cfg.ActorThumbs {
+		// The nfo points at the local copies of the headshots
+		info.ActorThumbs = downloadActorThumbs(ctx, f, info, filepath.Dir(finalPath))
+	}
+	nfoWriter := nfoWriterFor(cfg)
+	written, err := writeNFO(basePath+".nfo", info, nfoWriter, cfg.Force)
 	if err != nil {
-		fmt.Printf("Error loading config: %v\n", err)
-		return
+		slog.Error("Error writing nfo", "file", finalPath, "code", code, "err", err)
+		result.ScrapeErr = err
+		return result, nil
+	}
+	if written {
+		slog.Info("Scraped", "file", finalPath, "code", code, "nfo", filepath.Base(basePath)+".nfo")
+	} else {
+		slog.Info("Kept existing nfo, use -force to replace it", "file", finalPath, "nfo", filepath.Base(basePath)+".nfo")
 	}
 
-	fmt.Printf("Using config: %+v\n", config)
+	if cfg.ContainerTags {
+		if err := writeContainerTags(ctx, finalPath, info, cfg); err != nil {
+			slog.Warn("Error writing container tags", "file", finalPath, "err", err)
+		}
+	}
 
-	// Walk through the directory and find all video files
-	var videoFiles []string
-	err = filepath.Walk(config.FilePath, func(path string, info os.FileInfo, err error) error {
+	if err := downloadArtwork(ctx, f, info, basePath, nfoWriter, cfg); err != nil {
+		slog.Warn("Error downloading artwork", "file", finalPath, "code", code, "err", err)
+	}
+	if cfg.DownloadSamples && cfg.FolderMode {
+		if err := downloadSamples(ctx, f, info, filepath.Dir(finalPath), cfg); err != nil {
+			slog.Warn("Error downloading sample images", "file", finalPath, "code", code, "err", err)
+		}
+	}
+	if cfg.DownloadTrailer {
+		if err := downloadTrailer(ctx, f, info, basePath); err != nil {
+			slog.Warn("Error downloading trailer", "file", finalPath, "code", code, "err", err)
+		}
+	}
+
+	// Last, the downloads above touch the folder's mtime
+	if cfg.SetMTime {
+		if err := setReleaseMTime(finalPath, info, cfg); err != nil {
+			slog.Warn("Error setting modification time", "file", finalPath, "err", err)
+		}
+	}
+	return result, nil
+}
+
+// findVideoFiles walks root and returns the video files in it, leaving out
+// hidden and excluded paths, trailers, paths ignored by .scrapeignore files,
+// directories below MaxDepth, files not matching IncludeGlobs and files
+// outside MinSizeMB..MaxSizeMB. Unreadable entries are logged and skipped;
+// only an unreadable root fails the walk. The walk stops with ctx's error
+// once ctx is done, returning the files found so far.
+func findVideoFiles(ctx context.Context, root string, cfg Config) ([]string, error) {
+	var files []string
+	var ignorer scrapeIgnorer
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
+			if path == root {
+				return err
+			}
+			slog.Warn("Error reading, skipped", "path", path, "err", err)
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
 			return err
 		}
+		if reason := skippedPath(root, path, d.IsDir(), cfg, &ignorer); reason != "" {
+			slog.Debug("Skipped ("+reason+")", "path", path)
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
 		// Skip directories
-		if info.IsDir() {
+		if d.IsDir() {
+			ignorer.enter(path)
 			return nil
 		}
 		// Check if file extension matches any of the video types
-		for _, ext := range config.VideoTypes {
-			if strings.HasSuffix(strings.ToLower(path), ext) {
-				videoFiles = append(videoFiles, path)
-				break
-			}
+		if !isVideoFile(path, cfg.VideoTypes) {
+			return nil
+		}
+		// Only candidates are stat'ed, listing a directory doesn't need it
+		info, err := d.Info()
+		if err != nil {
+			slog.Warn("Error reading, skipped", "path", path, "err", err)
+			return nil
 		}
+		if reason := skippedVideo(path, info, cfg); reason != "" {
+			slog.Debug("Skipped ("+reason+")", "file", path, "size", info.Size())
+			return nil
+		}
+		files = append(files, path)
 		return nil
 	})
+	return files, err
+}
+
+// skippedPath returns why findVideoFiles leaves out path below root, or ""
+// when it doesn't: hidden and excluded paths, paths ignored by the
+// .scrapeignore files ignorer has entered, trailers, the trash and
+// directories below MaxDepth. The watcher filters its events with it too.
+func skippedPath(root, path string, isDir bool, cfg Config, ignorer *scrapeIgnorer) string {
+	switch {
+	case path == root:
+		return ""
+	case cfg.SkipHidden && isHiddenOrJunk(path):
+		return "hidden"
+	case isExcluded(path, isDir, cfg.ExcludePatterns):
+		return "excluded"
+	case !isDir && isTrailer(path):
+		return "trailer"
+	case ignorer.ignored(path, isDir):
+		return "excluded by " + scrapeIgnoreFile
+	case isDir && filepath.Base(path) == trashDir:
+		return "trash"
+	case isDir && cfg.MaxDepth > 0 && walkDepth(root, path) > cfg.MaxDepth:
+		return "too deep"
+	}
+	return ""
+}
 
+// skippedVideo returns why the video file at path, described by info, is
+// left out, or "" when it isn't: sizes outside MinSizeMB..MaxSizeMB and
+// files no IncludeGlobs match
+func skippedVideo(path string, info fs.FileInfo, cfg Config) string {
+	switch {
+	case info.Size() < cfg.MinSizeMB<<20:
+		return "too small"
+	case cfg.MaxSizeMB > 0 && info.Size() > cfg.MaxSizeMB<<20:
+		return "too large"
+	case !isIncluded(path, cfg.IncludeGlobs):
+		return "no include glob matches"
+	}
+	return ""
+}
+
+// sortPaths sorts paths case-insensitively, falling back to byte order for
+// names differing only in case
+func sortPaths(paths []string) {
+	slices.SortFunc(paths, func(a, b string) int {
+		if c := strings.Compare(strings.ToLower(a), strings.ToLower(b)); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+}
+
+// walkDepth returns how many levels below root path is, 1 for its direct
+// children
+func walkDepth(root, path string) int {
+	rel, err := filepath.Rel(root, path)
 	if err != nil {
-		fmt.Printf("Error walking directory: %v\n", err)
-		return
+		return 0
 	}
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
 
-	fmt.Printf("Found %d video files\n", len(videoFiles))
-	for _, file := range videoFiles {
-		movieCode := extractMovieCode(file)
-		newPath := filepath.Join(filepath.Dir(file), movieCode)
+// expandPath resolves a leading ~ to the home directory and expands $VAR
+// and ${VAR}. Paths without either are returned unchanged.
+func expandPath(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") || strings.HasPrefix(path, `~\`) {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = home + path[1:]
+		}
+	}
+	if strings.Contains(path, "$") {
+		path = os.ExpandEnv(path)
+	}
+	return path
+}
 
-		if file != newPath {
-			uniquePath := getUniqueFilePath(newPath)
-			err := os.Rename(file, uniquePath)
-			if err != nil {
-				fmt.Printf("Error renaming %s to %s: %v\n", file, uniquePath, err)
-				continue
+// expandConfigPaths runs expandPath over every path field of cfg
+func expandConfigPaths(cfg *Config) {
+	for _, p := range []*string{
+		&cfg.FilePath, &cfg.LogFile, &cfg.OutputDir, &cfg.OverridesFile,
+		&cfg.CookieFile, &cfg.GenreMapFile, &cfg.ActorAliasesFile, &cfg.CacheDB, &cfg.CacheDir,
+		&cfg.FFprobePath, &cfg.FFmpegPath, &cfg.LocalArtDir,
+	} {
+		*p = expandPath(*p)
+	}
+	for i := range cfg.FilePaths {
+		cfg.FilePaths[i] = expandPath(cfg.FilePaths[i])
+	}
+}
+
+// defaultVideoTypes is the VideoTypes of a new config file
+var defaultVideoTypes = []string{
+	".mp4", ".mkv", ".avi", ".wmv", ".mov", ".m4v", ".ts", ".m2ts",
+	".mpg", ".mpeg", ".flv", ".webm", ".rmvb", ".iso",
+}
+
+// normalizeExtensions lowercases and trims exts, dropping empty entries and
+// duplicates
+func normalizeExtensions(exts []string) []string {
+	var normalized []string
+	for _, ext := range exts {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext != "" && !slices.Contains(normalized, ext) {
+			normalized = append(normalized, ext)
+		}
+	}
+	return normalized
+}
+
+// isVideoFile reports whether path has one of the given extensions, which
+// must be lowercase
+func isVideoFile(path string, types []string) bool {
+	for _, ext := range types {
+		if strings.HasSuffix(strings.ToLower(path), ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// isFlagSet reports whether the named flag was given on the command line
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// Exit codes of the program
+const (
+	exitOK       = 0
+	exitFailures = 1 // some files failed to rename or scrape, or collided with -strict
+	exitConfig   = 2 // the config or flags are invalid
+)
+
+func main() {
+	os.Exit(run())
+}
+
+// run is the whole program, returning its exit code so deferred cleanup
+// happens before os.Exit
+func run() int {
+	dryRun := flag.Bool("dry-run", false, "preview renames without touching the filesystem")
+	force := flag.Bool("force", false, "overwrite existing nfo files and artwork and refresh cached metadata")
+	undo := flag.String("undo", "", "roll back the renames of the last run recorded in the given undo log")
+	undoRunFlag := flag.String("undo-run", "", "with -undo, roll back the run with this id instead of the last one")
+	folders := flag.Bool("folders", false, "move each movie into its own folder named after the code")
+	dedup := flag.Bool("dedup", false, "report duplicate videos and only process the best copy of each")
+	dedupRemove := flag.Bool("dedup-remove", false, "with -dedup, delete the extra copies with identical content")
+	dedupRemoveSameCode := flag.Bool("dedup-remove-same-code", false, "with -dedup-remove, also delete the other rips of the same code")
+	prune := flag.Bool("prune-orphans", false, "list nfo and artwork files whose video is gone, and exit")
+	pruneRemove := flag.Bool("prune-remove", false, "with -prune-orphans, delete them")
+	watch := flag.Bool("watch", false, "after the initial run, keep watching for new video files")
+	export := flag.String("export", "", "write an index of processed files: csv, json or csv,json")
+	interactive := flag.Bool("interactive", false, "confirm each rename on stdin")
+	fix := flag.Bool("fix", false, "recover the code of files without one from their .nfo or container title")
+	plan := flag.String("plan", "", "write the proposed renames to this JSON file instead of doing them")
+	apply := flag.String("apply", "", "carry out the renames of a plan file written by -plan")
+	codesFile := flag.String("codes", "", "scrape the codes listed one per line in this file into folders under output_dir, and exit")
+	strict := flag.Bool("strict", false, "exit with an error when files collide on the same name")
+	report := flag.Bool("report", false, "print the code found in every video file and how many files each pattern matched, and exit")
+	lookup := flag.String("lookup", "", "print the metadata scraped for a code, e.g. -lookup ABC-123, and exit")
+	quiet := flag.Bool("quiet", false, "don't show the progress bar")
+	noColor := flag.Bool("no-color", false, "don't color the console output, like setting NO_COLOR")
+	output := flag.String("output", "text", "result format on stdout: text, or json for one object per file")
+	configFile := flag.String("config", "config.json", "path to the config file")
+	path := flag.String("path", "", "directory or single video file to scan, overriding file_path/file_paths")
+	proxy := flag.String("proxy", "", "proxy address, e.g. http://127.0.0.1:7890 or socks5://127.0.0.1:1080")
+	types := flag.String("types", "", "comma-separated video extensions, e.g. .mp4,.mkv")
+	noCache := flag.Bool("no-cache", false, "don't use the page cache in cache_dir")
+	offline := flag.Bool("offline", false, "don't scrape any site, write nfo files with just the code")
+	showVersion := flag.Bool("version", false, "print the version and exit")
+	listSources := flag.Bool("list-sources", false, "list the sources usable in the sources setting and exit")
+	var assumeYes bool
+	flag.BoolVar(&assumeYes, "assume-yes", false, "don't ask before processing more than confirm_threshold files")
+	flag.BoolVar(&assumeYes, "y", false, "shorthand for -assume-yes")
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Println("ScrapeMovieData " + versionString())
+		return exitOK
+	}
+	if *listSources {
+		writeSourceList(os.Stdout)
+		return exitOK
+	}
+
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "Invalid -output %q, use text or json\n", *output)
+		return exitConfig
+	}
+	jsonOutput := *output == "json"
+	if jsonOutput {
+		consoleOut = os.Stderr
+	}
+	setColorOutput(*noColor)
+
+	fmt.Fprintln(consoleOut, "ScrapeMovieData "+versionString())
+	fmt.Fprintln(consoleOut, "hello world")
+
+	// Console logging until the config tells us otherwise
+	slog.SetDefault(slog.New(newConsoleHandler(consoleOut, slog.LevelInfo)))
+
+	if *undo != "" {
+		if err := runUndo(*undo, *undoRunFlag); err != nil {
+			slog.Error("Error undoing renames", "err", err)
+			return exitFailures
+		}
+		return exitOK
+	}
+
+	// Load config
+	config, err := loadConfig(*configFile)
+	if err != nil {
+		slog.Error("Error loading config", "err", err)
+		return exitConfig
+	}
+
+	// Command-line flags take precedence over config.json
+	if isFlagSet("dry-run") {
+		config.DryRun = *dryRun
+	}
+	if isFlagSet("folders") {
+		config.FolderMode = *folders
+	}
+	if isFlagSet("path") {
+		config.FilePath = *path
+		config.FilePaths = nil
+	}
+	if isFlagSet("proxy") {
+		config.ProxyAddr = *proxy
+	}
+	if isFlagSet("types") {
+		config.VideoTypes = nil
+		for _, ext := range strings.Split(*types, ",") {
+			if ext = strings.TrimSpace(ext); ext != "" {
+				config.VideoTypes = append(config.VideoTypes, ext)
 			}
-			fmt.Printf("Renamed: %s -> %s\n", file, filepath.Base(uniquePath))
+		}
+	}
+	config.Force = *force
+	config.Quiet = *quiet
+	config.NoCache = *noCache
+	if *offline {
+		config.Sources = []string{offlineSource}
+	}
+	if *plan != "" {
+		config.DryRun = true
+	}
+	if *interactive {
+		if isTerminal(os.Stdin) {
+			config.Interactive = true
 		} else {
-			fmt.Printf("Skipped: %s (already named correctly)\n", file)
+			slog.Warn("stdin is not a terminal, -interactive is ignored")
+		}
+	}
+
+	expandConfigPaths(&config)
+
+	if err := loadOverrides(&config); err != nil {
+		slog.Error("Error loading overrides", "err", err)
+		return exitConfig
+	}
+	if config.GenreMap, err = mergeMapFile(config.GenreMapFile, config.GenreMap); err != nil {
+		slog.Error("Error loading genre map file", "err", err)
+		return exitConfig
+	}
+	if config.ActorAliases, err = mergeMapFile(config.ActorAliasesFile, config.ActorAliases); err != nil {
+		slog.Error("Error loading actor aliases file", "err", err)
+		return exitConfig
+	}
+
+	if err := validateConfig(&config); err != nil {
+		slog.Error("Error loading config", "err", err)
+		return exitConfig
+	}
+
+	var exportFormats []string
+	if *export != "" {
+		for _, format := range strings.Split(*export, ",") {
+			format = strings.TrimSpace(format)
+			if format != "csv" && format != "json" {
+				slog.Error("Invalid -export format, use csv or json", "format", format)
+				return exitConfig
+			}
+			exportFormats = append(exportFormats, format)
 		}
 	}
+
+	closeLog, err := setupLogging(config)
+	if err != nil {
+		slog.Error("Error setting up logging", "err", err)
+		return exitConfig
+	}
+	defer closeLog()
+
+	slog.Info("Using config", "config", fmt.Sprintf("%+v", config))
+
+	// The first Ctrl-C stops handing out files and lets the ones in progress
+	// finish, a second one kills the process
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigCtx.Done()
+		stop()
+		slog.Warn("Interrupted, finishing the files in progress (Ctrl-C again to quit now)")
+	}()
+	ctx := sigCtx
+	if config.RunTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(config.RunTimeout)*time.Second)
+		defer cancel()
+	}
+
+	f, err := newFetcher(config)
+	if err != nil {
+		slog.Error("Error creating HTTP client", "err", err)
+		return exitConfig
+	}
+	defer f.close()
+
+	if *apply != "" {
+		applied, skipped, failed, remaining, err := applyPlan(ctx, *apply, config)
+		if err != nil {
+			slog.Error("Error applying plan", "err", err)
+			return exitConfig
+		}
+		slog.Info(fmt.Sprintf("Applied %d entries, %d skipped, %d failed, %d not applied", applied, skipped, failed, remaining))
+		if failed > 0 || remaining > 0 {
+			return exitFailures
+		}
+		return exitOK
+	}
+
+	if *codesFile != "" {
+		scraped, failed, err := runCodes(ctx, f, *codesFile, config)
+		if err != nil {
+			slog.Error("Error scraping codes", "err", err)
+			return exitConfig
+		}
+		slog.Info(fmt.Sprintf("Scraped %d codes, %d failed", scraped, failed))
+		if failed > 0 {
+			return exitFailures
+		}
+		return exitOK
+	}
+
+	if *lookup != "" {
+		if err := runLookup(ctx, f, os.Stdout, *lookup, config, jsonOutput); err != nil {
+			slog.Error("Error looking up code", "code", *lookup, "err", err)
+			return exitFailures
+		}
+		return exitOK
+	}
+
+	if *prune {
+		found, failed, err := pruneOrphans(ctx, config, *pruneRemove)
+		if err != nil {
+			slog.Error("Error looking for orphans", "err", err)
+			return exitFailures
+		}
+		if *pruneRemove && !config.DryRun {
+			slog.Info(fmt.Sprintf("Found %d orphaned files, %d failed to remove", found, failed))
+		} else {
+			slog.Info(fmt.Sprintf("Found %d orphaned files, use -prune-remove to delete them", found))
+		}
+		if failed > 0 {
+			return exitFailures
+		}
+		return exitOK
+	}
+
+	// Walk through the directories and find all video files
+	var videoFiles []string
+	seen := make(map[string]bool)
+	for _, dir := range sourceDirs(config) {
+		files, err := findVideoFiles(ctx, dir, config)
+		if errors.Is(err, context.DeadlineExceeded) {
+			slog.Error("Run timed out while scanning", "path", dir, "found", len(videoFiles)+len(files))
+			return exitFailures
+		}
+		if err != nil {
+			slog.Error("Error walking directory", "path", dir, "err", err)
+			return exitFailures
+		}
+		for _, file := range files {
+			// Overlapping source directories would list a file twice
+			if !seen[file] {
+				seen[file] = true
+				videoFiles = append(videoFiles, file)
+			}
+		}
+	}
+
+	// Walk order depends on the filesystem; sorting makes logs and collision
+	// suffixes the same from run to run
+	sortPaths(videoFiles)
+	slog.Info("Found video files", "count", len(videoFiles))
+	if *report {
+		writeReport(os.Stdout, videoFiles, config)
+		return exitOK
+	}
+
+	var unrecovered []string
+	if *fix {
+		videoFiles, config, unrecovered = prepareFix(ctx, videoFiles, config)
+		slog.Info("Recovered codes", "count", len(videoFiles), "unrecovered", len(unrecovered))
+	}
+	if *dedup {
+		videoFiles = dedupFiles(ctx, videoFiles, config, *dedupRemove, *dedupRemoveSameCode)
+	}
+	if !config.DryRun && !assumeYes && config.ConfirmThreshold > 0 && len(videoFiles) > config.ConfirmThreshold {
+		if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+			slog.Error(fmt.Sprintf("Refusing to process %d files without confirmation, more than confirm_threshold (%d)", len(videoFiles), config.ConfirmThreshold),
+				"hint", "check file_path, then rerun with -y or raise confirm_threshold")
+			return exitConfig
+		}
+		if !confirmPrompt.confirmBatch(len(videoFiles), sourceDirs(config)) {
+			slog.Info("Cancelled, nothing was renamed")
+			return exitOK
+		}
+	}
+	results := processFiles(ctx, videoFiles, config, f)
+
+	renamed, skipped, failed := countResults(results)
+	if jsonOutput {
+		for _, result := range results {
+			writeJSONResult(os.Stdout, result)
+		}
+		writeJSONSummary(os.Stdout, len(results), renamed, skipped, failed)
+	}
+	timedOut := errors.Is(ctx.Err(), context.DeadlineExceeded)
+	if timedOut {
+		slog.Error(fmt.Sprintf("Run timed out after %d of %d files", len(results), len(videoFiles)))
+	} else if ctx.Err() != nil {
+		slog.Warn(fmt.Sprintf("Stopped after %d of %d files", len(results), len(videoFiles)))
+	}
+	verb := "Renamed"
+	if config.DryRun {
+		verb = "Would rename"
+	}
+	slog.Info(fmt.Sprintf("%s %d of %d files, %d skipped, %d failed", verb, renamed, len(results), skipped, failed))
+
+	for _, file := range unrecovered {
+		slog.Warn("No code found, fix by hand", "file", file)
+	}
+	collisions := findCollisions(results)
+	logCollisions(collisions)
+
+	if config.NotifyWebhook != "" {
+		// Still notify about a run that was stopped or timed out
+		notifyCtx, cancelNotify := context.WithTimeout(context.WithoutCancel(ctx), requestTimeout(config))
+		if err := notifyWebhook(notifyCtx, f, config, results); err != nil {
+			slog.Warn("Error sending notification", "err", err)
+		}
+		cancelNotify()
+	}
+
+	if *plan != "" {
+		if err := writePlan(*plan, results); err != nil {
+			slog.Error("Error writing plan", "err", err)
+			return exitFailures
+		}
+	}
+
+	if config.Manifest && !config.DryRun {
+		if err := writeManifest(results, config); err != nil {
+			slog.Error("Error writing manifest", "err", err)
+		}
+	}
+
+	for _, format := range exportFormats {
+		if err := exportIndex(format, results); err != nil {
+			slog.Error("Error exporting index", "format", format, "err", err)
+		}
+	}
+
+	if *watch && ctx.Err() == nil {
+		var onResult func(fileResult)
+		if jsonOutput {
+			onResult = func(result fileResult) { writeJSONResult(os.Stdout, result) }
+		}
+		if err := watchDirs(ctx, config, f, onResult); err != nil {
+			slog.Error("Error watching directories", "err", err)
+		}
+	}
+
+	if failed > 0 || timedOut || (*strict && len(collisions) > 0) {
+		return exitFailures
+	}
+	return exitOK
 }
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// writeTree creates the files under root, sized in bytes
+func writeTree(t *testing.T, root string, files map[string]int64) {
+	t.Helper()
+	for name, size := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Truncate(path, size); err != nil {
+			t.Fatal(err)
+		}
+		// Old enough for isFileStable not to wait
+		old := time.Now().Add(-time.Hour)
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// relPaths returns paths relative to root, slash-separated and sorted
+func relPaths(t *testing.T, root string, paths []string) []string {
+	t.Helper()
+	var rel []string
+	for _, path := range paths {
+		r, err := filepath.Rel(root, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rel = append(rel, filepath.ToSlash(r))
+	}
+	slices.Sort(rel)
+	return rel
+}
+
+func TestFindVideoFiles(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  map[string]int64
+		ignore string
+		cfg    func(*Config)
+		want   []string
+	}{
+		{
+			name:  "video types",
+			files: map[string]int64{"ABC-123.mp4": 1, "ABC-124.MKV": 1, "notes.txt": 1, "ABC-125.nfo": 1},
+			want:  []string{"ABC-123.mp4", "ABC-124.MKV"},
+		},
+		{
+			name:  "hidden",
+			files: map[string]int64{"ABC-123.mp4": 1, ".ABC-124.mp4": 1, "._ABC-123.mp4": 1, ".hidden/ABC-125.mp4": 1},
+			want:  []string{"ABC-123.mp4"},
+		},
+		{
+			name:  "hidden kept",
+			files: map[string]int64{"ABC-123.mp4": 1, ".hidden/ABC-125.mp4": 1},
+			cfg:   func(cfg *Config) { cfg.SkipHidden = false },
+			want:  []string{".hidden/ABC-125.mp4", "ABC-123.mp4"},
+		},
+		{
+			name:  "exclude patterns",
+			files: map[string]int64{"ABC-123.mp4": 1, "sample/ABC-123.mp4": 1, "ABC-124-sample.mp4": 1, "keep/ABC-125.mp4": 1},
+			cfg:   func(cfg *Config) { cfg.ExcludePatterns = []string{"sample", "*-sample.mp4"} },
+			want:  []string{"ABC-123.mp4", "keep/ABC-125.mp4"},
+		},
+		{
+			name:  "trash",
+			files: map[string]int64{"ABC-123.mp4": 1, trashDir + "/ABC-123.mp4": 1},
+			cfg:   func(cfg *Config) { cfg.SkipHidden = false },
+			want:  []string{"ABC-123.mp4"},
+		},
+		{
+			name:  "max depth",
+			files: map[string]int64{"ABC-123.mp4": 1, "a/ABC-124.mp4": 1, "a/b/ABC-125.mp4": 1},
+			cfg:   func(cfg *Config) { cfg.MaxDepth = 1 },
+			want:  []string{"ABC-123.mp4", "a/ABC-124.mp4"},
+		},
+		{
+			name:  "size limits",
+			files: map[string]int64{"ABC-123.mp4": 2 << 20, "ABC-124.mp4": 1, "ABC-125.mp4": 8 << 20},
+			cfg:   func(cfg *Config) { cfg.MinSizeMB, cfg.MaxSizeMB = 1, 4 },
+			want:  []string{"ABC-123.mp4"},
+		},
+		{
+			name:  "include globs",
+			files: map[string]int64{"ABC-123.mp4": 1, "XYZ-123.mp4": 1},
+			cfg:   func(cfg *Config) { cfg.IncludeGlobs = []string{"abc-*"} },
+			want:  []string{"ABC-123.mp4"},
+		},
+		{
+			name:   "scrapeignore",
+			files:  map[string]int64{"ABC-123.mp4": 1, "done/ABC-124.mp4": 1, "done/keep/ABC-125.mp4": 1, "ABC-126-old.mp4": 1},
+			ignore: "done/\n!keep/\n*-old.mp4\n",
+			want:   []string{"ABC-123.mp4"},
+		},
+		{
+			name:  "trailers",
+			files: map[string]int64{"ABC-123.mp4": 1, "ABC-123-trailer.mp4": 1, "ABC-124-Trailer.mkv": 1},
+			want:  []string{"ABC-123.mp4"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeTree(t, root, tt.files)
+			if tt.ignore != "" {
+				if err := os.WriteFile(filepath.Join(root, scrapeIgnoreFile), []byte(tt.ignore), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cfg := Config{VideoTypes: defaultVideoTypes, SkipHidden: true}
+			if tt.cfg != nil {
+				tt.cfg(&cfg)
+			}
+			files, err := findVideoFiles(context.Background(), root, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := relPaths(t, root, files); !slices.Equal(got, tt.want) {
+				t.Errorf("findVideoFiles = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindVideoFilesMissingRoot(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "missing")
+	if _, err := findVideoFiles(context.Background(), root, Config{VideoTypes: defaultVideoTypes}); err == nil {
+		t.Error("findVideoFiles on a missing root succeeded")
+	}
+}
+
+func TestExtractMovieCode(t *testing.T) {
+	tests := []struct {
+		filename  string
+		want      string
+		subtitled bool
+	}{
+		{"ABC-123.mp4", "ABC-123.mp4", false},
+		{"abc-123.mkv", "ABC-123.mkv", false},
+		{"[ThZu.Cc]abc-123.mp4", "ABC-123.mp4", false},
+		{"(2020) abc-123.mp4", "ABC-123.mp4", false},
+		{"xyz-42 (1080p).mp4", "XYZ-42.mp4", false},
+		{"abc-123-c.mp4", "ABC-123-C.mp4", true},
+		{"abc-123-uc.mkv", "ABC-123-UC.mkv", true},
+		{"ABC-123-CD1.mp4", "ABC-123-CD1.mp4", false},
+		{"ABC-123-cd2.mp4", "ABC-123-CD2.mp4", false},
+		{"ABC-123-B.mp4", "ABC-123-CD2.mp4", false},
+		{"ABC-123-CD1-C.mp4", "ABC-123-C-CD1.mp4", true},
+		{"ABC-123-A-B.mp4", "ABC-123.mp4", false},
+		{"/videos/sub/ABC-123.mp4", "ABC-123.mp4", false},
+		{"random video.mp4", "random video.mp4", false},
+	}
+	for _, tt := range tests {
+		got, subtitled := extractMovieCode(tt.filename, Config{})
+		if got != tt.want || subtitled != tt.subtitled {
+			t.Errorf("extractMovieCode(%q) = %q, %v, want %q, %v", tt.filename, got, subtitled, tt.want, tt.subtitled)
+		}
+	}
+}
+
+func TestExtractMovieCodeCase(t *testing.T) {
+	tests := []struct {
+		codeCase string
+		filename string
+		want     string
+	}{
+		{"upper", "abc-123-cd1.mp4", "ABC-123-CD1.mp4"},
+		{"lower", "ABC-123-CD1.mp4", "abc-123-cd1.mp4"},
+		{"original", "abc-123-cd1.mp4", "abc-123-cd1.mp4"},
+		{"original", "Abc-123-CD1.mp4", "Abc-123-CD1.mp4"},
+	}
+	for _, tt := range tests {
+		if got, _ := extractMovieCode(tt.filename, Config{CodeCase: tt.codeCase}); got != tt.want {
+			t.Errorf("extractMovieCode(%q) with code case %s = %q, want %q", tt.filename, tt.codeCase, got, tt.want)
+		}
+	}
+}
+
+// testSource registers a javbus scraper reading from a test server run by
+// handler as the source "test", and returns the fetcher and a config using it
+func testSource(t *testing.T, handler http.HandlerFunc) (*fetcher, Config) {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	scrapers["test"] = func() Scraper { return &javbusScraper{baseURL: srv.URL + "/"} }
+	t.Cleanup(func() { delete(scrapers, "test") })
+
+	cfg := Config{
+		VideoTypes:   defaultVideoTypes,
+		Sources:      []string{"test"},
+		CodeCase:     "upper",
+		NameTemplate: defaultNameTemplate,
+	}
+	return &fetcher{client: srv.Client()}, cfg
+}
+
+func TestProcessFileTimeout(t *testing.T) {
+	// The source hangs until the file's timeout ends the request
+	f, cfg := testSource(t, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	root := t.TempDir()
+	writeTree(t, root, map[string]int64{"abc-123.mp4": 1})
+	file := filepath.Join(root, "abc-123.mp4")
+
+	ctx, cancel := context.WithTimeoutCause(context.Background(), 50*time.Millisecond, errFileTimeout)
+	defer cancel()
+	result, err := processFile(ctx, file, cfg, f)
+	if !errors.Is(err, errFileTimeout) {
+		t.Errorf("processFile err = %v, want errFileTimeout", err)
+	}
+	if result.Renamed || result.NewPath != file {
+		t.Errorf("processFile result = %+v, want the file left alone", result)
+	}
+	if got := relPaths(t, root, listFiles(t, root)); !slices.Equal(got, []string{"abc-123.mp4"}) {
+		t.Errorf("files after timeout = %q, want only abc-123.mp4", got)
+	}
+}
+
+// listFiles returns every file below root
+func listFiles(t *testing.T, root string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			files = append(files, path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// chdirTemp runs the rest of the test in a temporary directory, so the undo
+// log lands there
+func chdirTemp(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestProcessFile(t *testing.T) {
+	page, err := os.ReadFile(filepath.Join("testdata", "javbus_ABC-123.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chdirTemp(t)
+	f, baseCfg := testSource(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ABC-123" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(page)
+	})
+
+	tests := []struct {
+		name      string
+		files     map[string]int64
+		file      string
+		dryRun    bool
+		want      []string
+		newPath   string
+		collision bool
+		scrapeErr bool
+	}{
+		{
+			name:    "rename",
+			files:   map[string]int64{"abc-123.mp4": 1},
+			file:    "abc-123.mp4",
+			want:    []string{"ABC-123.mp4", "ABC-123.nfo"},
+			newPath: "ABC-123.mp4",
+		},
+		{
+			name:    "dry run",
+			files:   map[string]int64{"abc-123.mp4": 1},
+			file:    "abc-123.mp4",
+			dryRun:  true,
+			want:    []string{"abc-123.mp4"},
+			newPath: "ABC-123.mp4",
+		},
+		{
+			name:      "collision",
+			files:     map[string]int64{"abc-123.mp4": 1, "ABC-123.mp4": 2},
+			file:      "abc-123.mp4",
+			want:      []string{"ABC-123.mp4", "ABC-123_1.mp4", "ABC-123_1.nfo"},
+			newPath:   "ABC-123_1.mp4",
+			collision: true,
+		},
+		{
+			name:      "scrape failure",
+			files:     map[string]int64{"xyz-999.mp4": 1},
+			file:      "xyz-999.mp4",
+			want:      []string{"XYZ-999.mp4"},
+			newPath:   "XYZ-999.mp4",
+			scrapeErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeTree(t, root, tt.files)
+			cfg := baseCfg
+			cfg.DryRun = tt.dryRun
+
+			result, err := processFile(context.Background(), filepath.Join(root, tt.file), cfg, f)
+			if err != nil {
+				t.Fatalf("processFile: %v", err)
+			}
+			if !result.Renamed || result.NewPath != filepath.Join(root, tt.newPath) {
+				t.Errorf("processFile renamed = %v to %q, want %q", result.Renamed, result.NewPath, tt.newPath)
+			}
+			if (result.Collision != "") != tt.collision {
+				t.Errorf("processFile collision = %q, want one: %v", result.Collision, tt.collision)
+			}
+			if (result.ScrapeErr != nil) != tt.scrapeErr {
+				t.Errorf("processFile scrape error = %v, want one: %v", result.ScrapeErr, tt.scrapeErr)
+			}
+			if !tt.scrapeErr && !tt.dryRun && result.Info.Title != "Sample Title" {
+				t.Errorf("processFile title = %q, want Sample Title", result.Info.Title)
+			}
+			if got := relPaths(t, root, listFiles(t, root)); !slices.Equal(got, tt.want) {
+				t.Errorf("files = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// manifestFile is written to the working directory after a run with
+// Manifest set
+const manifestFile = "manifest.json"
+
+// manifest records what a run moved where, for verifying backups
+type manifest struct {
+	Version string          `json:"version"`
+	Created time.Time       `json:"created"`
+	Files   []manifestEntry `json:"files"`
+}
+
+// manifestEntry is one processed file. Status is renamed, skipped or
+// failed; Path is where the file is now and Error why it failed, or why its
+// scrape did. SHA256 is only filled in with ManifestHash.
+type manifestEntry struct {
+	Original string `json:"original"`
+	Path     string `json:"path"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Size     int64  `json:"size"`
+	SHA256   string `json:"sha256,omitempty"`
+}
+
+// manifestStatus returns the Status of result in the manifest
+func manifestStatus(result fileResult) string {
+	switch {
+	case result.Err != nil:
+		return "failed"
+	case result.Renamed:
+		return "renamed"
+	default:
+		return "skipped"
+	}
+}
+
+// writeManifest lists every file of results in manifestFile, with what
+// happened to it
+func writeManifest(results []fileResult, cfg Config) error {
+	m := manifest{Version: versionString(), Created: time.Now(), Files: []manifestEntry{}}
+	for _, result := range results {
+		entry := manifestEntry{Original: result.File, Path: result.NewPath, Status: manifestStatus(result)}
+		if result.Err != nil {
+			entry.Error = result.Err.Error()
+		} else if result.ScrapeErr != nil {
+			entry.Error = result.ScrapeErr.Error()
+		}
+		info, err := os.Stat(result.NewPath)
+		if err != nil {
+			// A failed file may be gone, the others should be there
+			if entry.Status != "failed" {
+				slog.Warn("Error reading file for the manifest", "file", result.NewPath, "err", err)
+			}
+			m.Files = append(m.Files, entry)
+			continue
+		}
+		entry.Size = info.Size()
+		if cfg.ManifestHash {
+			if entry.SHA256, err = hashFile(result.NewPath); err != nil {
+				slog.Warn("Error hashing file for the manifest", "file", result.NewPath, "err", err)
+			}
+		}
+		m.Files = append(m.Files, entry)
+	}
+
+	data, err := json.MarshalIndent(m, "", "    ")
+	if err != nil {
+		return fmt.Errorf("error encoding manifest: %v", err)
+	}
+	if err := os.WriteFile(manifestFile, data, 0644); err != nil {
+		return fmt.Errorf("error writing %s: %v", manifestFile, err)
+	}
+	slog.Info("Wrote manifest", "file", manifestFile, "entries", len(m.Files))
+	return nil
+}
+
+// hashFile returns the hex SHA-256 of the file at path, read as a stream
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
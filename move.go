@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// linkModes are the values allowed for Config.LinkMode
+var linkModes = []string{"move", "copy", "hardlink", "symlink"}
+
+// linkMode returns the effective LinkMode of cfg
+func linkMode(cfg Config) string {
+	switch {
+	case cfg.LinkMode != "":
+		return cfg.LinkMode
+	case cfg.CopyMode:
+		return "copy"
+	default:
+		return "move"
+	}
+}
+
+// transferFile puts src at dst the way cfg.LinkMode asks for. Links that
+// can't be made, e.g. across filesystems, become copies, which stop when ctx
+// is done.
+func transferFile(ctx context.Context, src, dst string, cfg Config) error {
+	switch linkMode(cfg) {
+	case "copy":
+		return copyFile(ctx, src, dst)
+	case "hardlink":
+		err := os.Link(src, dst)
+		if err == nil || !linkUnsupported(err) {
+			return err
+		}
+		slog.Debug("Can't hardlink, copying", "from", src, "to", dst, "err", err)
+		return copyFile(ctx, src, dst)
+	case "symlink":
+		target, err := filepath.Abs(src)
+		if err != nil {
+			return fmt.Errorf("error resolving %s: %v", src, err)
+		}
+		err = os.Symlink(target, dst)
+		if err == nil || !linkUnsupported(err) {
+			return err
+		}
+		slog.Debug("Can't symlink, copying", "from", src, "to", dst, "err", err)
+		return copyFile(ctx, src, dst)
+	default:
+		return moveFile(ctx, src, dst)
+	}
+}
+
+// linkUnsupported reports whether a link error means the filesystem can't
+// link here, rather than a problem with the paths themselves
+func linkUnsupported(err error) bool {
+	return !errors.Is(err, fs.ErrExist) && !errors.Is(err, fs.ErrNotExist)
+}
+
+// recordUndo logs a finished transfer so -undo can roll it back. Copies and
+// links leave the source in place and have nothing to undo.
+func recordUndo(src, dst string, cfg Config) {
+	if linkMode(cfg) != "move" {
+		return
+	}
+	if err := appendUndoEntry(undoLogFile, src, dst); err != nil {
+		slog.Warn("Error recording undo entry", "file", src, "err", err)
+	}
+}
+
+// releaseDateLayout is the format sources give release dates in
+const releaseDateLayout = "2006-01-02"
+
+// setReleaseMTime sets the mtime of path, and of its folder in folder mode,
+// to info's release date. Unknown or unparseable dates are skipped. Linked
+// files are left alone, changing them would change the originals too.
+func setReleaseMTime(path string, info MovieInfo, cfg Config) error {
+	if mode := linkMode(cfg); mode == "hardlink" || mode == "symlink" {
+		return nil
+	}
+	released, err := time.ParseInLocation(releaseDateLayout, strings.TrimSpace(info.ReleaseDate), time.Local)
+	if err != nil {
+		slog.Debug("No usable release date", "file", path, "date", info.ReleaseDate)
+		return nil
+	}
+
+	if err := os.Chtimes(path, time.Now(), released); err != nil {
+		return err
+	}
+	if cfg.FolderMode {
+		return os.Chtimes(filepath.Dir(path), time.Now(), released)
+	}
+	return nil
+}
+
+// moveFile renames src to dst, copying and then deleting src when they are
+// on different filesystems
+func moveFile(ctx context.Context, src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	slog.Debug("Cross-device move, copying", "from", src, "to", dst)
+	if err := copyFile(ctx, src, dst); err != nil {
+		return err
+	}
+	if err := os.Remove(src); err != nil {
+		return fmt.Errorf("error removing %s after copy: %v", src, err)
+	}
+	return nil
+}
+
+// copyFile copies src to dst through a temp file in dst's directory, so dst
+// only appears once the copy is complete. The file mode is kept. A copy cut
+// off by ctx leaves nothing behind.
+func copyFile(ctx context.Context, src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("error opening source: %v", err)
+	}
+	defer in.Close()
+	srcInfo, err := in.Stat()
+	if err != nil {
+		return fmt.Errorf("error reading source info: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating temp file: %v", err)
+	}
+	tmpPath := tmp.Name()
+	ok := false
+	defer func() {
+		if !ok {
+			tmp.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	written, err := io.Copy(tmp, contextReader{ctx, in})
+	if err != nil {
+		return fmt.Errorf("error copying %s: %v", src, err)
+	}
+	if written != srcInfo.Size() {
+		return fmt.Errorf("error copying %s: wrote %d of %d bytes", src, written, srcInfo.Size())
+	}
+	if err := tmp.Chmod(srcInfo.Mode().Perm()); err != nil {
+		return fmt.Errorf("error setting file mode: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("error flushing copy: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error closing copy: %v", err)
+	}
+
+	if err := os.Rename(tmpPath, dst); err != nil {
+		return fmt.Errorf("error moving copy into place: %v", err)
+	}
+	ok = true
+	return nil
+}
+
+// contextReader fails reads with ctx's error once ctx is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
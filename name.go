@@ -0,0 +1,98 @@
+package main
+
+import (
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// defaultNameTemplate keeps the plain <CODE><ext> naming
+const defaultNameTemplate = "{{.Code}}{{.Ext}}"
+
+// nameData are the variables available to Config.NameTemplate
+type nameData struct {
+	Code       string // movie code, including part and resolution suffixes
+	Resolution string
+	Title      string
+	Actor      string
+	Studio     string
+	Year       string
+	Ext        string
+}
+
+// metadataFieldPattern matches the nameData fields that come from the
+// scraped metadata rather than the file name
+var metadataFieldPattern = regexp.MustCompile(`\.(Title|Actor|Studio|Year)\b`)
+
+// nameNeedsMetadata reports whether the name template or, in folder mode,
+// OrganizeBy use scraped metadata, so dry runs have to scrape to show the
+// real target
+func nameNeedsMetadata(cfg Config) bool {
+	if cfg.FolderMode && organizeNeedsMetadata(cfg.OrganizeBy) {
+		return true
+	}
+	return metadataFieldPattern.MatchString(cfg.NameTemplate)
+}
+
+// nameTemplateCache holds parsed name templates keyed by their source
+var nameTemplateCache sync.Map
+
+// compileNameTemplate parses text once and caches the result
+func compileNameTemplate(text string) (*template.Template, error) {
+	if tmpl, ok := nameTemplateCache.Load(text); ok {
+		return tmpl.(*template.Template), nil
+	}
+	tmpl, err := template.New("name").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	nameTemplateCache.Store(text, tmpl)
+	return tmpl, nil
+}
+
+// renderName returns the new file name for file from the name template.
+// info is the scraped metadata, empty when scraping failed or was skipped.
+func renderName(file string, cfg Config, info MovieInfo) string {
+	movieCode, _ := extractMovieCode(file, cfg)
+	if findFileCode(file, cfg) == "" {
+		return movieCode
+	}
+
+	ext := filepath.Ext(movieCode)
+	data := nameData{
+		Code:       strings.TrimSuffix(movieCode, ext),
+		Resolution: extractResolution(strings.TrimSuffix(filepath.Base(file), ext)),
+		Title:      info.Title,
+		Studio:     info.Studio,
+		Ext:        ext,
+	}
+	if len(info.Actors) > 0 {
+		data.Actor = info.Actors[0]
+	}
+	if len(info.ReleaseDate) >= 4 {
+		data.Year = info.ReleaseDate[:4]
+	}
+
+	text := cfg.NameTemplate
+	if text == "" {
+		text = defaultNameTemplate
+	}
+	tmpl, err := compileNameTemplate(text)
+	if err != nil {
+		// Invalid templates are reported by validateConfig
+		return movieCode
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		slog.Warn("Error rendering name template", "file", file, "err", err)
+		return movieCode
+	}
+	name := b.String()
+	if strings.HasSuffix(name, ext) {
+		return sanitizePath(strings.TrimSuffix(name, ext), ext)
+	}
+	return sanitizePath(name, "")
+}
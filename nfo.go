@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// nfoMovie is the <movie> nfo schema, covering the elements of every
+// NFOWriter dialect
+type nfoMovie struct {
+	XMLName     xml.Name      `xml:"movie"`
+	Title       string        `xml:"title"`
+	UniqueIDs   []nfoUniqueID `xml:"uniqueid"`
+	Premiered   string        `xml:"premiered,omitempty"`
+	ReleaseDate string        `xml:"releasedate,omitempty"`
+	Year        string        `xml:"year,omitempty"`
+	Studio      string        `xml:"studio,omitempty"`
+	Genres      []string      `xml:"genre"`
+	Actors      []nfoActor    `xml:"actor"`
+	Tags        []string      `xml:"tag"`
+	Set         *nfoSet       `xml:"set,omitempty"`
+	Thumbs      []nfoThumb    `xml:"thumb"`
+	Fanart      *nfoFanart    `xml:"fanart,omitempty"`
+	Art         *nfoArt       `xml:"art,omitempty"`
+}
+
+// nfoUniqueID identifies the movie to media servers re-scraping it
+type nfoUniqueID struct {
+	Type    string `xml:"type,attr"`
+	Default string `xml:"default,attr,omitempty"`
+	ID      string `xml:",chardata"`
+}
+
+type nfoActor struct {
+	Name  string `xml:"name"`
+	Thumb string `xml:"thumb,omitempty"`
+}
+
+// nfoSet is the collection a movie belongs to
+type nfoSet struct {
+	Name string `xml:"name"`
+}
+
+// nfoThumb is an image URL, aspect telling Kodi what kind of image it is
+type nfoThumb struct {
+	Aspect string `xml:"aspect,attr,omitempty"`
+	URL    string `xml:",chardata"`
+}
+
+type nfoFanart struct {
+	Thumbs []nfoThumb `xml:"thumb"`
+}
+
+// nfoArt points at the local artwork files
+type nfoArt struct {
+	Poster string `xml:"poster,omitempty"`
+	Fanart string `xml:"fanart,omitempty"`
+}
+
+// subtitledTag marks movies with Chinese subtitles in the nfo
+const subtitledTag = "中文字幕"
+
+// nfoMarker starts the comment written into every nfo this tool creates.
+// The comment lists the genres and tags that were scraped, as nfoScraped
+// JSON, so a later -force can tell them from the ones added by hand.
+const nfoMarker = "<!-- scraped-by ScrapeMovieInfo"
+
+// nfoMarkerPattern finds the marker comment and its JSON, if it has any.
+// Markers written before the JSON was added are just the prefix.
+var nfoMarkerPattern = regexp.MustCompile(`<!-- scraped-by ScrapeMovieInfo ?(.*?) ?-->`)
+
+// nfoScraped are the genres and tags a marker comment records
+type nfoScraped struct {
+	Genres []string `json:"genres,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+}
+
+// nfoMarkerComment returns the marker comment recording movie's genres and
+// tags. "--" can't appear in a comment, the JSON escapes it.
+func nfoMarkerComment(movie nfoMovie) string {
+	data, err := json.Marshal(nfoScraped{Genres: movie.Genres, Tags: movie.Tags})
+	if err != nil {
+		return nfoMarker + " -->\n"
+	}
+	return nfoMarker + " " + strings.ReplaceAll(string(data), "--", `-\u002d`) + " -->\n"
+}
+
+// writeNFO writes info as an nfo file at path in the dialect of w. An existing
+// nfo may have been edited by hand, so it is left alone unless force is set;
+// even then the tags and genres added to it by hand are kept. written reports
+// whether the file was written.
+func writeNFO(path string, info MovieInfo, w NFOWriter, force bool) (written bool, err error) {
+	_, user, err := readNFO(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil && !force:
+		return false, err
+	case err != nil:
+		slog.Debug("Replacing unreadable nfo", "file", path, "err", err)
+	case !force:
+		return false, nil
+	}
+
+	movie := w.Movie(info, strings.TrimSuffix(path, filepath.Ext(path)))
+	marker := nfoMarkerComment(movie)
+	movie.Genres = appendMissing(movie.Genres, user.Genres)
+	movie.Tags = appendMissing(movie.Tags, user.Tags)
+
+	data, err := xml.MarshalIndent(movie, "", "    ")
+	if err != nil {
+		return false, fmt.Errorf("error encoding nfo: %v", err)
+	}
+	data = append([]byte(xml.Header+marker), data...)
+
+	err = os.WriteFile(path, data, 0644)
+	if err != nil {
+		return false, fmt.Errorf("error writing nfo file: %v", err)
+	}
+	return true, nil
+}
+
+// baseNFO fills in the elements all dialects write the same way
+func baseNFO(info MovieInfo) nfoMovie {
+	movie := nfoMovie{
+		Title:     info.Code,
+		UniqueIDs: []nfoUniqueID{{Type: "num", Default: "true", ID: info.Code}},
+		Premiered: info.ReleaseDate,
+		Studio:    info.Studio,
+		Genres:    info.Genres,
+	}
+	if info.Source != "" && info.SourceID != "" {
+		movie.UniqueIDs = append(movie.UniqueIDs, nfoUniqueID{Type: info.Source, ID: info.SourceID})
+	}
+	// The offline scraper's title is just the code
+	if info.Title != info.Code {
+		movie.Title += " " + info.Title
+	}
+	if len(info.ReleaseDate) >= 4 {
+		movie.Year = info.ReleaseDate[:4]
+	}
+	for _, actor := range info.Actors {
+		movie.Actors = append(movie.Actors, nfoActor{Name: actor, Thumb: info.ActorThumbs[actor]})
+	}
+	if info.Subtitled {
+		movie.Tags = append(movie.Tags, subtitledTag)
+	}
+	if info.Set != "" {
+		movie.Set = &nfoSet{Name: info.Set}
+	}
+	return movie
+}
+
+// readNFO parses the nfo at path. user are its genres and tags that weren't
+// scraped: the ones its marker doesn't list, all of them in an nfo without
+// a marker, and none in one with a marker from before the list was
+// recorded, there's no telling them apart.
+func readNFO(path string) (movie nfoMovie, user nfoScraped, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return movie, user, err
+	}
+	if err := xml.Unmarshal(data, &movie); err != nil {
+		return movie, user, fmt.Errorf("error parsing nfo: %v", err)
+	}
+
+	m := nfoMarkerPattern.FindSubmatch(data)
+	if m == nil {
+		return movie, nfoScraped{Genres: movie.Genres, Tags: movie.Tags}, nil
+	}
+	var scraped nfoScraped
+	if len(m[1]) == 0 || json.Unmarshal(m[1], &scraped) != nil {
+		return movie, user, nil
+	}
+	for _, genre := range movie.Genres {
+		if !slices.Contains(scraped.Genres, genre) {
+			user.Genres = append(user.Genres, genre)
+		}
+	}
+	for _, tag := range movie.Tags {
+		if !slices.Contains(scraped.Tags, tag) {
+			user.Tags = append(user.Tags, tag)
+		}
+	}
+	return movie, user, nil
+}
+
+// appendMissing appends the values of extra that aren't in values yet
+func appendMissing(values, extra []string) []string {
+	for _, v := range extra {
+		if !slices.Contains(values, v) {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWriteNFO(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ABC-123.nfo")
+	info := MovieInfo{Code: "ABC-123", Title: "Sample Title", Genres: []string{"Drama"}}
+
+	written, err := writeNFO(path, info, kodiNFO{}, false)
+	if err != nil || !written {
+		t.Fatalf("writeNFO = %v, %v, want it written", written, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), nfoMarker) {
+		t.Errorf("nfo has no marker:\n%s", data)
+	}
+
+	// An existing nfo is left alone without force
+	info.Genres = []string{"Romance"}
+	if written, err := writeNFO(path, info, kodiNFO{}, false); err != nil || written {
+		t.Errorf("writeNFO over an existing nfo = %v, %v, want it skipped", written, err)
+	}
+}
+
+func TestWriteNFOKeepsUserEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ABC-123.nfo")
+	info := MovieInfo{Code: "ABC-123", Genres: []string{"Drama", "Romance"}, Subtitled: true}
+	if _, err := writeNFO(path, info, kodiNFO{}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// Add a genre and a tag by hand
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited := strings.Replace(string(data), "</movie>", "    <genre>Favorite</genre>\n    <tag>watched</tag>\n</movie>", 1)
+	if err := os.WriteFile(path, []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The source dropped Romance and the subtitles are gone
+	info.Genres = []string{"Drama", "Comedy"}
+	info.Subtitled = false
+	if _, err := writeNFO(path, info, kodiNFO{}, true); err != nil {
+		t.Fatal(err)
+	}
+	movie, _, err := readNFO(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Drama", "Comedy", "Favorite"}; !slices.Equal(movie.Genres, want) {
+		t.Errorf("genres = %q, want %q", movie.Genres, want)
+	}
+	if want := []string{"watched"}; !slices.Equal(movie.Tags, want) {
+		t.Errorf("tags = %q, want %q", movie.Tags, want)
+	}
+}
+
+func TestReadNFOUserEntries(t *testing.T) {
+	tests := []struct {
+		name   string
+		marker string
+		want   nfoScraped
+	}{
+		{"no marker", "", nfoScraped{Genres: []string{"Drama", "Favorite"}, Tags: []string{"watched"}}},
+		{"old marker", nfoMarker + " -->\n", nfoScraped{}},
+		{"marker", nfoMarker + ` {"genres":["Drama"]} -->` + "\n", nfoScraped{Genres: []string{"Favorite"}, Tags: []string{"watched"}}},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "ABC-123.nfo")
+		data := `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + tt.marker +
+			"<movie><title>ABC-123</title><genre>Drama</genre><genre>Favorite</genre><tag>watched</tag></movie>\n"
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, user, err := readNFO(path)
+		if err != nil {
+			t.Errorf("%s: readNFO: %v", tt.name, err)
+			continue
+		}
+		if !slices.Equal(user.Genres, tt.want.Genres) || !slices.Equal(user.Tags, tt.want.Tags) {
+			t.Errorf("%s: user entries = %+v, want %+v", tt.name, user, tt.want)
+		}
+	}
+}
+
+func TestNFOMarkerCommentEscapesDashes(t *testing.T) {
+	comment := nfoMarkerComment(nfoMovie{Genres: []string{"a--b"}})
+	body := strings.TrimSuffix(strings.TrimPrefix(comment, "<!--"), "-->\n")
+	if strings.Contains(body, "--") {
+		t.Errorf("marker comment %q contains --", comment)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// NFOWriter is one media server's take on the nfo format and on where the
+// artwork next to a video goes
+type NFOWriter interface {
+	// Movie builds the nfo document for info. basePath is the video path
+	// without its extension.
+	Movie(info MovieInfo, basePath string) nfoMovie
+	// ArtworkPaths returns where the poster and fanart of the video at
+	// basePath are saved
+	ArtworkPaths(basePath string) (poster, fanart string)
+}
+
+// nfoWriters maps the values of Config.NFOFormat to their dialect
+var nfoWriters = map[string]NFOWriter{
+	"kodi":     kodiNFO{},
+	"jellyfin": jellyfinNFO{},
+	"emby":     embyNFO{},
+}
+
+// defaultNFOFormat is used when the config doesn't set NFOFormat
+const defaultNFOFormat = "kodi"
+
+// nfoFormats lists the NFOFormat values for error messages
+func nfoFormats() string {
+	formats := make([]string, 0, len(nfoWriters))
+	for format := range nfoWriters {
+		formats = append(formats, format)
+	}
+	slices.Sort(formats)
+	return strings.Join(formats, ", ")
+}
+
+// nfoWriterFor returns the dialect selected by cfg
+func nfoWriterFor(cfg Config) NFOWriter {
+	if w, ok := nfoWriters[cfg.NFOFormat]; ok {
+		return w
+	}
+	return nfoWriters[defaultNFOFormat]
+}
+
+// kodiNFO links the remote images, Kodi caches them itself
+type kodiNFO struct{}
+
+func (kodiNFO) Movie(info MovieInfo, basePath string) nfoMovie {
+	movie := baseNFO(info)
+	if info.PosterURL != "" {
+		movie.Thumbs = append(movie.Thumbs, nfoThumb{Aspect: "poster", URL: info.PosterURL})
+	}
+	if info.CoverURL != "" {
+		movie.Thumbs = append(movie.Thumbs, nfoThumb{Aspect: "landscape", URL: info.CoverURL})
+		movie.Fanart = &nfoFanart{Thumbs: []nfoThumb{{URL: info.CoverURL}}}
+	}
+	return movie
+}
+
+func (kodiNFO) ArtworkPaths(basePath string) (poster, fanart string) {
+	return basePath + "-poster.jpg", basePath + "-fanart.jpg"
+}
+
+// jellyfinNFO points <art> at the downloaded images
+type jellyfinNFO struct{}
+
+func (w jellyfinNFO) Movie(info MovieInfo, basePath string) nfoMovie {
+	movie := baseNFO(info)
+	poster, fanart := w.ArtworkPaths(basePath)
+	var art nfoArt
+	if info.PosterURL != "" {
+		art.Poster = filepath.Base(poster)
+	}
+	if info.CoverURL != "" {
+		art.Fanart = filepath.Base(fanart)
+	}
+	if art != (nfoArt{}) {
+		movie.Art = &art
+	}
+	return movie
+}
+
+func (jellyfinNFO) ArtworkPaths(basePath string) (poster, fanart string) {
+	return basePath + "-poster.jpg", basePath + "-fanart.jpg"
+}
+
+// embyNFO also writes <releasedate>, and Emby takes <video>.jpg as the poster
+type embyNFO struct{}
+
+func (embyNFO) Movie(info MovieInfo, basePath string) nfoMovie {
+	movie := baseNFO(info)
+	movie.ReleaseDate = info.ReleaseDate
+	return movie
+}
+
+func (embyNFO) ArtworkPaths(basePath string) (poster, fanart string) {
+	return basePath + ".jpg", basePath + "-fanart.jpg"
+}
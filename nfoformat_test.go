@@ -0,0 +1,112 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testMovieInfo is scraped metadata with every field the dialects write
+var testMovieInfo = MovieInfo{
+	Code:        "ABC-123",
+	Title:       "Sample Title",
+	ReleaseDate: "2020-01-02",
+	Studio:      "Sample Studio",
+	Actors:      []string{"Actor One"},
+	Genres:      []string{"Drama"},
+	CoverURL:    "https://example.com/cover.jpg",
+	PosterURL:   "https://example.com/poster.jpg",
+	ActorThumbs: map[string]string{"Actor One": "https://example.com/one.jpg"},
+	Subtitled:   true,
+	Source:      "javbus",
+	SourceID:    "ABC-123",
+}
+
+// testBaseNFO is the part of testMovieInfo's nfo every dialect shares
+func testBaseNFO() nfoMovie {
+	return nfoMovie{
+		Title: "ABC-123 Sample Title",
+		UniqueIDs: []nfoUniqueID{
+			{Type: "num", Default: "true", ID: "ABC-123"},
+			{Type: "javbus", ID: "ABC-123"},
+		},
+		Premiered: "2020-01-02",
+		Year:      "2020",
+		Studio:    "Sample Studio",
+		Genres:    []string{"Drama"},
+		Actors:    []nfoActor{{Name: "Actor One", Thumb: "https://example.com/one.jpg"}},
+		Tags:      []string{subtitledTag},
+	}
+}
+
+func TestNFOWriterMovie(t *testing.T) {
+	kodi := testBaseNFO()
+	kodi.Thumbs = []nfoThumb{
+		{Aspect: "poster", URL: "https://example.com/poster.jpg"},
+		{Aspect: "landscape", URL: "https://example.com/cover.jpg"},
+	}
+	kodi.Fanart = &nfoFanart{Thumbs: []nfoThumb{{URL: "https://example.com/cover.jpg"}}}
+
+	jellyfin := testBaseNFO()
+	jellyfin.Art = &nfoArt{Poster: "ABC-123-poster.jpg", Fanart: "ABC-123-fanart.jpg"}
+
+	emby := testBaseNFO()
+	emby.ReleaseDate = "2020-01-02"
+
+	tests := []struct {
+		format string
+		want   nfoMovie
+	}{
+		{"kodi", kodi},
+		{"jellyfin", jellyfin},
+		{"emby", emby},
+	}
+	for _, tt := range tests {
+		got := nfoWriters[tt.format].Movie(testMovieInfo, "/videos/ABC-123")
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s Movie = %+v, want %+v", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestNFOWriterMovieWithoutArtwork(t *testing.T) {
+	info := MovieInfo{Code: "ABC-123", Title: "ABC-123"}
+	for format, w := range nfoWriters {
+		movie := w.Movie(info, "/videos/ABC-123")
+		if movie.Title != "ABC-123" {
+			t.Errorf("%s Movie title = %q, want the code alone", format, movie.Title)
+		}
+		if movie.Thumbs != nil || movie.Fanart != nil || movie.Art != nil {
+			t.Errorf("%s Movie has artwork without images: %+v", format, movie)
+		}
+		if len(movie.UniqueIDs) != 1 {
+			t.Errorf("%s Movie uniqueids = %+v, want only num without a source", format, movie.UniqueIDs)
+		}
+	}
+}
+
+func TestNFOWriterArtworkPaths(t *testing.T) {
+	tests := []struct {
+		format string
+		poster string
+		fanart string
+	}{
+		{"kodi", "/videos/ABC-123-poster.jpg", "/videos/ABC-123-fanart.jpg"},
+		{"jellyfin", "/videos/ABC-123-poster.jpg", "/videos/ABC-123-fanart.jpg"},
+		{"emby", "/videos/ABC-123.jpg", "/videos/ABC-123-fanart.jpg"},
+	}
+	for _, tt := range tests {
+		poster, fanart := nfoWriters[tt.format].ArtworkPaths("/videos/ABC-123")
+		if poster != tt.poster || fanart != tt.fanart {
+			t.Errorf("%s ArtworkPaths = %q, %q, want %q, %q", tt.format, poster, fanart, tt.poster, tt.fanart)
+		}
+	}
+}
+
+func TestNFOWriterFor(t *testing.T) {
+	if _, ok := nfoWriterFor(Config{}).(kodiNFO); !ok {
+		t.Error("nfoWriterFor without NFOFormat isn't kodi")
+	}
+	if _, ok := nfoWriterFor(Config{NFOFormat: "emby"}).(embyNFO); !ok {
+		t.Error("nfoWriterFor emby isn't emby")
+	}
+}
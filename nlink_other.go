@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// linkCount returns the number of hardlinks of the file fi describes. Only
+// unix reports it, elsewhere every file counts as a single link.
+func linkCount(fi os.FileInfo) uint64 {
+	return 1
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// notifyMaxErrors is how many errors a notification lists
+const notifyMaxErrors = 5
+
+// notifyPayload is the JSON posted to NotifyWebhook. Content is what
+// Discord shows; generic webhooks can use the other fields.
+type notifyPayload struct {
+	Content string   `json:"content"`
+	Total   int      `json:"total"`
+	Renamed int      `json:"renamed"`
+	Skipped int      `json:"skipped"`
+	Failed  int      `json:"failed"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+// notifyWebhook posts the run summary to cfg.NotifyWebhook through the
+// shared client. With NotifyOnlyOnError, clean runs send nothing.
+func notifyWebhook(ctx context.Context, f *fetcher, cfg Config, results []fileResult) error {
+	renamed, skipped, failed := countResults(results)
+	if failed == 0 && cfg.NotifyOnlyOnError {
+		return nil
+	}
+
+	verb := "renamed"
+	if cfg.DryRun {
+		verb = "would rename"
+	}
+	payload := notifyPayload{
+		Content: fmt.Sprintf("ScrapeMovieInfo: %s %d of %d files, %d skipped, %d failed", verb, renamed, len(results), skipped, failed),
+		Total:   len(results),
+		Renamed: renamed,
+		Skipped: skipped,
+		Failed:  failed,
+	}
+	for _, result := range results {
+		if len(payload.Errors) == notifyMaxErrors {
+			break
+		}
+		err := result.Err
+		if err == nil {
+			err = result.ScrapeErr
+		}
+		if err != nil {
+			payload.Errors = append(payload.Errors, fmt.Sprintf("%s: %v", result.File, err))
+		}
+	}
+	for _, e := range payload.Errors {
+		payload.Content += "\n" + e
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error encoding notification: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", cfg.NotifyWebhook, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting notification: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status posting notification: %s", resp.Status)
+	}
+	return nil
+}
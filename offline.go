@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+	"net/http"
+)
+
+// offlineSource is the name of the offline scraper in Config.Sources
+const offlineSource = "offline"
+
+// offlineScraper makes no requests at all: the title is just the code, so
+// an nfo can still be written without network. As the last entry of
+// Sources it is the fallback when every site failed.
+type offlineScraper struct{}
+
+func (offlineScraper) Fetch(ctx context.Context, client *http.Client, code string) (MovieInfo, error) {
+	return MovieInfo{Code: code, Title: code}, nil
+}
+
+func (offlineScraper) Name() string { return offlineSource }
+
+func (offlineScraper) Describe() sourceInfo {
+	return sourceInfo{Codes: "any code, the nfo gets just the code as its title"}
+}
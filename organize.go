@@ -0,0 +1,78 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// organizeFields are the values accepted by Config.OrganizeBy
+var organizeFields = []string{"actor", "studio", "year", "genre", "prefix"}
+
+// organizeNeedsMetadata reports whether the OrganizeBy field by comes from
+// the scraped metadata rather than from the code
+func organizeNeedsMetadata(by string) bool {
+	return by != "" && by != "prefix"
+}
+
+// organizeFolder returns the folder the movie with code is grouped under for
+// cfg.OrganizeBy, "Unknown" when the metadata doesn't have the field
+func organizeFolder(info MovieInfo, code string, cfg Config) string {
+	var name string
+	switch cfg.OrganizeBy {
+	case "actor":
+		if len(info.Actors) > 0 {
+			name = info.Actors[0]
+		}
+	case "studio":
+		name = info.Studio
+	case "year":
+		if len(info.ReleaseDate) >= 4 {
+			name = info.ReleaseDate[:4]
+		}
+	case "genre":
+		if len(info.Genres) > 0 {
+			name = info.Genres[0]
+		}
+	case "prefix":
+		name = codePrefix(code, cfg.OrganizePrefixLen)
+	}
+	return sanitizeFolderName(name)
+}
+
+// codePrefix returns the label of code, the part before the first - or _,
+// cut to its first length characters when length is not 0
+func codePrefix(code string, length int) string {
+	label := code
+	if i := strings.IndexAny(label, "-_"); i >= 0 {
+		label = label[:i]
+	}
+	if runes := []rune(label); length > 0 && len(runes) > length {
+		label = string(runes[:length])
+	}
+	return label
+}
+
+// sanitizeFolderName makes s usable as a folder name, see sanitizePath
+func sanitizeFolderName(s string) string {
+	return sanitizePath(s, "")
+}
+
+// sourceRoot returns the configured source directory that contains file,
+// or the file's own directory when none does
+func sourceRoot(file string, cfg Config) string {
+	root := ""
+	for _, dir := range sourceDirs(cfg) {
+		rel, err := filepath.Rel(dir, file)
+		// rel is "." when the source is file itself
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if len(dir) > len(root) {
+			root = dir
+		}
+	}
+	if root == "" {
+		return filepath.Dir(file)
+	}
+	return root
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// jsonResult is the -output json record written for every processed file
+type jsonResult struct {
+	Original string `json:"original"`
+	Renamed  string `json:"renamed"`
+	Code     string `json:"code"`
+	Skipped  bool   `json:"skipped"`
+	Error    string `json:"error"`
+}
+
+// jsonSummary is the last -output json record of a run
+type jsonSummary struct {
+	Summary bool `json:"summary"`
+	Total   int  `json:"total"`
+	Renamed int  `json:"renamed"`
+	Skipped int  `json:"skipped"`
+	Failed  int  `json:"failed"`
+}
+
+// countResults tallies results for the run summary. A renamed file whose
+// scrape failed counts as both renamed and failed.
+func countResults(results []fileResult) (renamed, skipped, failed int) {
+	for _, result := range results {
+		if result.Renamed {
+			renamed++
+		}
+		if result.Err != nil || result.ScrapeErr != nil {
+			failed++
+		} else if !result.Renamed {
+			skipped++
+		}
+	}
+	return renamed, skipped, failed
+}
+
+// writeJSONResult writes result to w as a single line of JSON
+func writeJSONResult(w io.Writer, result fileResult) {
+	record := jsonResult{
+		Original: result.File,
+		Code:     result.Code,
+	}
+	if result.Renamed {
+		record.Renamed = result.NewPath
+	}
+	switch {
+	case result.Err != nil:
+		record.Error = result.Err.Error()
+	case result.ScrapeErr != nil:
+		record.Error = result.ScrapeErr.Error()
+	case !result.Renamed:
+		record.Skipped = true
+	}
+	json.NewEncoder(w).Encode(record)
+}
+
+// writeJSONSummary writes the final summary record to w
+func writeJSONSummary(w io.Writer, total, renamed, skipped, failed int) {
+	json.NewEncoder(w).Encode(jsonSummary{
+		Summary: true,
+		Total:   total,
+		Renamed: renamed,
+		Skipped: skipped,
+		Failed:  failed,
+	})
+}
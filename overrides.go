@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// loadOverrides merges the entries of cfg.OverridesFile into cfg.Overrides,
+// keeping the ones already set in the config
+func loadOverrides(cfg *Config) error {
+	merged, err := mergeMapFile(cfg.OverridesFile, cfg.Overrides)
+	if err != nil {
+		return fmt.Errorf("error loading overrides file: %v", err)
+	}
+	cfg.Overrides = merged
+	return nil
+}
+
+// mergeMapFile reads a JSON object of strings from path and adds the entries
+// of inline on top. An empty path just returns inline.
+func mergeMapFile(path string, inline map[string]string) (map[string]string, error) {
+	if path == "" {
+		return inline, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var fromFile map[string]string
+	if err := json.Unmarshal(data, &fromFile); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", path, err)
+	}
+
+	merged := make(map[string]string, len(fromFile)+len(inline))
+	for key, value := range fromFile {
+		merged[key] = value
+	}
+	for key, value := range inline {
+		merged[key] = value
+	}
+	return merged, nil
+}
+
+// overrideCode returns the overridden code for the file at path, if any. A
+// key naming the path as given, cleaned or absolute wins over the exact base
+// name, which wins over regexes on the base name, tried in sorted order.
+// Path keys tell apart same-named files in different folders.
+func overrideCode(path string, cfg Config) (string, bool) {
+	if len(cfg.Overrides) == 0 {
+		return "", false
+	}
+	keys := []string{path, filepath.Clean(path)}
+	if abs, err := filepath.Abs(path); err == nil {
+		keys = append(keys, abs)
+	}
+	name := filepath.Base(path)
+	for _, key := range append(keys, name) {
+		if code, ok := cfg.Overrides[key]; ok {
+			return code, true
+		}
+	}
+
+	var patterns []string
+	for key := range cfg.Overrides {
+		if strings.HasPrefix(key, regexPrefix) {
+			patterns = append(patterns, key)
+		}
+	}
+	slices.Sort(patterns)
+	for _, key := range patterns {
+		re, err := compilePattern(strings.TrimPrefix(key, regexPrefix))
+		if err == nil && re.MatchString(name) {
+			return cfg.Overrides[key], true
+		}
+	}
+	return "", false
+}
+
+// validateOverride checks that key is a usable pattern and code is not empty
+func validateOverride(key, code string) error {
+	if strings.TrimSpace(code) == "" {
+		return errors.New("code is empty")
+	}
+	if expr, ok := strings.CutPrefix(key, regexPrefix); ok {
+		_, err := compilePattern(expr)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOverrideCode(t *testing.T) {
+	root := t.TempDir()
+	cfg := Config{Overrides: map[string]string{
+		"movie.mp4":                        "ABC-001",
+		filepath.Join(root, "a/movie.mp4"): "ABC-002",
+		"re:^clip":                         "ABC-003",
+		"clip.mp4":                         "ABC-004",
+	}}
+	tests := []struct {
+		path string
+		want string
+		ok   bool
+	}{
+		{filepath.Join(root, "a/movie.mp4"), "ABC-002", true},
+		{filepath.Join(root, "a/./movie.mp4"), "ABC-002", true},
+		{filepath.Join(root, "b/movie.mp4"), "ABC-001", true},
+		{"movie.mp4", "ABC-001", true},
+		{filepath.Join(root, "clip.mp4"), "ABC-004", true},
+		{filepath.Join(root, "clip2.mp4"), "ABC-003", true},
+		{filepath.Join(root, "other.mp4"), "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := overrideCode(tt.path, cfg); got != tt.want || ok != tt.ok {
+			t.Errorf("overrideCode(%q) = %q, %v, want %q, %v", tt.path, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestPrepareFixSameNames(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]int64{"a/movie.mp4": 1, "b/movie.mp4": 1})
+	for dir, code := range map[string]string{"a": "ABC-001", "b": "ABC-002"} {
+		nfo := "<movie><title>" + code + "</title><uniqueid>" + code + "</uniqueid></movie>"
+		if err := os.WriteFile(filepath.Join(root, dir, "movie.nfo"), []byte(nfo), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := []string{filepath.Join(root, "a/movie.mp4"), filepath.Join(root, "b/movie.mp4")}
+
+	// No ffprobe, the codes come from the nfo files
+	fixable, cfg, unrecovered := prepareFix(context.Background(), files, Config{FFprobePath: filepath.Join(root, "no-ffprobe")})
+	if len(fixable) != 2 || len(unrecovered) != 0 {
+		t.Fatalf("prepareFix = %q fixable, %q unrecovered, want both fixable", fixable, unrecovered)
+	}
+	for file, want := range map[string]string{files[0]: "ABC-001", files[1]: "ABC-002"} {
+		if got := findFileCode(file, cfg); got != want {
+			t.Errorf("findFileCode(%q) after prepareFix = %q, want %q", file, got, want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// pageCache is a round tripper keeping the raw responses of scraped pages
+// under dir, so they can be parsed again without fetching them. Only HTML
+// pages and redirects are kept; images and partial requests go straight
+// to base.
+type pageCache struct {
+	base http.RoundTripper
+	dir  string
+	// ttl is how long a page is served from disk, 0 means forever
+	ttl time.Duration
+}
+
+func (c *pageCache) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != "GET" || req.Header.Get("Range") != "" {
+		return c.base.RoundTrip(req)
+	}
+
+	path := c.path(req.URL.String())
+	if resp, ok := c.load(path, req); ok {
+		slog.Debug("Using cached page", "url", req.URL.String())
+		return resp, nil
+	}
+
+	resp, err := c.base.RoundTrip(req)
+	if err != nil || !cacheablePage(resp) {
+		return resp, err
+	}
+	// DumpResponse reads the body and puts a copy back for the caller
+	data, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", req.URL, err)
+	}
+	if err := c.store(path, data); err != nil {
+		slog.Warn("Error writing page cache", "url", req.URL.String(), "err", err)
+	}
+	return resp, nil
+}
+
+// path returns the cache file for url
+func (c *pageCache) path(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".http")
+}
+
+// load returns the cached response at path unless it is missing or expired
+func (c *pageCache) load(path string, req *http.Request) (*http.Response, bool) {
+	info, err := os.Stat(path)
+	if err != nil || (c.ttl > 0 && time.Since(info.ModTime()) > c.ttl) {
+		return nil, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), req)
+	if err != nil {
+		slog.Debug("Ignoring broken cached page", "file", path, "err", err)
+		return nil, false
+	}
+	return resp, true
+}
+
+// store writes data to path through a temp file, so readers never see half
+// a response
+func (c *pageCache) store(path string, data []byte) error {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(c.dir, ".page-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// cacheablePage reports whether resp is an HTML page or a redirect
+func cacheablePage(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	case http.StatusOK:
+		return strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html")
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// planEntry is one proposed rename in a -plan file
+type planEntry struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// writePlan saves the renames a dry run would do to path, for review with
+// -apply later
+func writePlan(path string, results []fileResult) error {
+	entries := []planEntry{}
+	for _, result := range results {
+		if result.Renamed {
+			entries = append(entries, planEntry{From: result.File, To: result.NewPath})
+		}
+	}
+
+	data, err := json.MarshalIndent(entries, "", "    ")
+	if err != nil {
+		return fmt.Errorf("error encoding plan: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("error writing %s: %v", path, err)
+	}
+	slog.Info("Wrote plan", "file", path, "entries", len(entries))
+	return nil
+}
+
+// applyPlan carries out the renames of a plan file. Entries whose source is
+// gone are skipped and targets that have been taken in the meantime go
+// through CollisionPolicy, just like a normal run. Once ctx is done no
+// further entry is started, the rename in progress is finished, and the
+// entries left are returned as remaining.
+func applyPlan(ctx context.Context, path string, cfg Config) (applied, skipped, failed, remaining int, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0, 0, 0, fmt.Errorf("error reading plan: %v", err)
+	}
+	var entries []planEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return 0, 0, 0, 0, fmt.Errorf("error parsing plan: %v", err)
+	}
+
+	for i, entry := range entries {
+		if ctx.Err() != nil {
+			remaining = len(entries) - i
+			slog.Warn(fmt.Sprintf("Stopped, %d entries not applied", remaining))
+			break
+		}
+		if entry.From == "" || entry.To == "" || entry.From == entry.To {
+			skipped++
+			continue
+		}
+		if _, err := os.Stat(entry.From); err != nil {
+			slog.Warn("Skipped (source is gone)", "file", entry.From)
+			skipped++
+			continue
+		}
+		if !cfg.DryRun {
+			if err := os.MkdirAll(filepath.Dir(entry.To), 0755); err != nil {
+				slog.Error("Error creating folder", "file", entry.From, "err", err)
+				failed++
+				continue
+			}
+		}
+		renameMu.Lock()
+		target, _, err := resolveCollision(ctx, entry.From, entry.To, cfg)
+		done := target == entry.From || alreadyTransferred(ctx, entry.From, target, cfg)
+		if err != nil || target == "" || done || cfg.DryRun {
+			renameMu.Unlock()
+			switch {
+			case err != nil:
+				slog.Error("Error renaming", "file", entry.From, "to", entry.To, "err", err)
+				failed++
+			case target == "":
+				slog.Info("Skipped (target exists)", "file", entry.From, "target", entry.To)
+				skipped++
+			case done:
+				slog.Info("Skipped (already named correctly)", "file", entry.From, "target", target)
+				skipped++
+			default:
+				slog.Info("Renamed", "file", entry.From, "to", target)
+				applied++
+			}
+			continue
+		}
+		reservePath(target)
+		renameMu.Unlock()
+		// A started rename is finished even when ctx is cancelled now
+		fileCtx, cancel := finishContext(ctx)
+		err = transferFile(fileCtx, entry.From, target, cfg)
+		releasePath(target)
+		if err != nil {
+			cancel()
+			slog.Error("Error renaming", "file", entry.From, "to", target, "err", err)
+			failed++
+			continue
+		}
+		recordUndo(entry.From, target, cfg)
+		slog.Info("Renamed", "file", entry.From, "to", target)
+		renameSubtitles(fileCtx, entry.From, target, cfg)
+		cancel()
+		applied++
+	}
+	return applied, skipped, failed, remaining, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyPlanStopsWhenCancelled(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]int64{"abc-123.mp4": 1, "abc-124.mp4": 1})
+	entries := []planEntry{
+		{From: filepath.Join(root, "abc-123.mp4"), To: filepath.Join(root, "ABC-123.mp4")},
+		{From: filepath.Join(root, "abc-124.mp4"), To: filepath.Join(root, "ABC-124.mp4")},
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	planPath := filepath.Join(t.TempDir(), "plan.json")
+	if err := os.WriteFile(planPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	applied, skipped, failed, remaining, err := applyPlan(ctx, planPath, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied != 0 || skipped != 0 || failed != 0 || remaining != 2 {
+		t.Errorf("applyPlan = %d applied, %d skipped, %d failed, %d remaining, want 2 remaining", applied, skipped, failed, remaining)
+	}
+	for _, entry := range entries {
+		if _, err := os.Stat(entry.From); err != nil {
+			t.Errorf("entry source %s was touched: %v", entry.From, err)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+)
+
+// VideoStats is what ffprobe reports about a video file
+type VideoStats struct {
+	Width    int
+	Height   int
+	Bitrate  int64
+	Duration float64
+}
+
+// ffprobeOutput is the subset of `ffprobe -of json` output we read
+type ffprobeOutput struct {
+	Streams []struct {
+		Width  int `json:"width"`
+		Height int `json:"height"`
+	} `json:"streams"`
+	Format struct {
+		BitRate  string `json:"bit_rate"`
+		Duration string `json:"duration"`
+	} `json:"format"`
+}
+
+// probeVideo reads the resolution, bitrate and duration of path with
+// ffprobe, killing it once ctx is done
+func probeVideo(ctx context.Context, path string, cfg Config) (VideoStats, error) {
+	out, err := exec.CommandContext(ctx, ffprobeBinary(cfg),
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "stream=width,height:format=bit_rate,duration",
+		"-of", "json",
+		path,
+	).Output()
+	if err != nil {
+		return VideoStats{}, fmt.Errorf("error running ffprobe on %s: %w", path, err)
+	}
+
+	var probe ffprobeOutput
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return VideoStats{}, fmt.Errorf("error parsing ffprobe output: %v", err)
+	}
+
+	var stats VideoStats
+	if len(probe.Streams) > 0 {
+		stats.Width = probe.Streams[0].Width
+		stats.Height = probe.Streams[0].Height
+	}
+	stats.Bitrate, _ = strconv.ParseInt(probe.Format.BitRate, 10, 64)
+	stats.Duration, _ = strconv.ParseFloat(probe.Format.Duration, 64)
+	return stats, nil
+}
+
+// ffprobeBinary returns the configured ffprobe, defaulting to the one on PATH
+func ffprobeBinary(cfg Config) string {
+	if cfg.FFprobePath == "" {
+		return "ffprobe"
+	}
+	return cfg.FFprobePath
+}
+
+// ffprobeMissing is warned about once per run
+var ffprobeMissing sync.Once
+
+// bestVideo returns the highest quality file of group, ranked by resolution,
+// then bitrate, then duration. Without ffprobe it falls back to file size.
+func bestVideo(ctx context.Context, group []string, cfg Config) string {
+	type ranked struct {
+		file  string
+		stats VideoStats
+		size  int64
+	}
+
+	var candidates []ranked
+	useProbe := true
+	for _, file := range group {
+		r := ranked{file: file}
+		if info, err := os.Stat(file); err == nil {
+			r.size = info.Size()
+		}
+		if useProbe {
+			fileCtx, cancel := stepContext(ctx, cfg)
+			stats, err := probeVideo(fileCtx, file, cfg)
+			cancel()
+			if errors.Is(err, exec.ErrNotFound) {
+				ffprobeMissing.Do(func() {
+					slog.Warn("ffprobe not found, ranking duplicates by file size", "ffprobe", ffprobeBinary(cfg))
+				})
+				useProbe = false
+			} else if err != nil {
+				slog.Warn("Error probing video", "file", file, "err", err)
+			}
+			r.stats = stats
+		}
+		candidates = append(candidates, r)
+	}
+
+	better := func(a, b ranked) bool {
+		if useProbe {
+			if pa, pb := a.stats.Width*a.stats.Height, b.stats.Width*b.stats.Height; pa != pb {
+				return pa > pb
+			}
+			if a.stats.Bitrate != b.stats.Bitrate {
+				return a.stats.Bitrate > b.stats.Bitrate
+			}
+			if a.stats.Duration != b.stats.Duration {
+				return a.stats.Duration > b.stats.Duration
+			}
+		}
+		return a.size > b.size
+	}
+
+	best := candidates[0]
+	for _, c := range candidates[1:] {
+		if better(c, best) {
+			best = c
+		}
+	}
+	return best.file
+}
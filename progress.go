@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// consoleMu serializes everything written to consoleOut, so log lines and
+// the progress bar don't tear each other apart
+var consoleMu sync.Mutex
+
+// activeProgress is the progress bar currently shown, nil when there is none
+var activeProgress atomic.Pointer[progress]
+
+// progressWidth is the number of cells in the progress bar
+const progressWidth = 30
+
+// progressLogInterval is how often progress is logged when the console
+// isn't a terminal
+const progressLogInterval = 5 * time.Second
+
+// progress counts processed files. On a terminal it keeps a bar on the last
+// line, redrawn in place; otherwise it logs the count every few seconds.
+type progress struct {
+	w     io.Writer
+	tty   bool
+	total int
+
+	mu         sync.Mutex
+	done       int
+	lastLogged time.Time
+}
+
+// startProgress shows a progress bar for total files on consoleOut
+func startProgress(total int) *progress {
+	p := &progress{w: consoleOut, total: total, lastLogged: time.Now()}
+	if f, ok := consoleOut.(*os.File); ok {
+		p.tty = isTerminal(f)
+	}
+	activeProgress.Store(p)
+	if p.tty {
+		consoleMu.Lock()
+		io.WriteString(p.w, p.line(0))
+		consoleMu.Unlock()
+	}
+	return p
+}
+
+// step records one more finished file. It is safe for concurrent use.
+func (p *progress) step() {
+	p.mu.Lock()
+	p.done++
+	done := p.done
+	logNow := !p.tty && (done == p.total || time.Since(p.lastLogged) >= progressLogInterval)
+	if logNow {
+		p.lastLogged = time.Now()
+	}
+	p.mu.Unlock()
+
+	if p.tty {
+		consoleMu.Lock()
+		io.WriteString(p.w, "\r"+p.line(done))
+		consoleMu.Unlock()
+	} else if logNow {
+		slog.Info(fmt.Sprintf("Progress %d/%d", done, p.total))
+	}
+}
+
+// stop removes the progress bar
+func (p *progress) stop() {
+	activeProgress.CompareAndSwap(p, nil)
+	if p.tty {
+		consoleMu.Lock()
+		io.WriteString(p.w, "\r\033[K")
+		consoleMu.Unlock()
+	}
+}
+
+// redraw returns the bar as it currently stands, for the console handler to
+// put back below a log line
+func (p *progress) redraw() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.line(p.done)
+}
+
+// line renders the bar for done files, e.g. "[###     ] 320/1080"
+func (p *progress) line(done int) string {
+	filled := progressWidth
+	if p.total > 0 {
+		filled = done * progressWidth / p.total
+	}
+	return fmt.Sprintf("[%s%s] %d/%d", strings.Repeat("#", filled), strings.Repeat(" ", progressWidth-filled), done, p.total)
+}
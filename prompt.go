@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// errQuit is returned by processFile when the user quits an interactive run
+var errQuit = errors.New("quit by user")
+
+// renamePrompt asks the user to confirm each rename in -interactive mode
+type renamePrompt struct {
+	mu  sync.Mutex
+	in  *bufio.Reader
+	all bool
+}
+
+// confirmPrompt is shared by all workers so only one question is asked at a time
+var confirmPrompt = &renamePrompt{in: bufio.NewReader(os.Stdin)}
+
+// confirm asks whether file should be renamed to newPath. It returns errQuit
+// when the user chooses to stop the run.
+func (p *renamePrompt) confirm(file, newPath string) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.all {
+		return true, nil
+	}
+	for {
+		fmt.Fprintf(consoleOut, "Rename %s -> %s? [y]es / [n]o / [a]ll / [q]uit: ", file, newPath)
+		line, err := p.in.ReadString('\n')
+		if err != nil && line == "" {
+			// stdin closed, treat it like quitting
+			return false, errQuit
+		}
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		case "a", "all":
+			p.all = true
+			return true, nil
+		case "q", "quit":
+			return false, errQuit
+		}
+	}
+}
+
+// confirmBatch asks whether a run touching count files under the given
+// directories should go ahead. Anything but yes, stdin closing included,
+// means no.
+func (p *renamePrompt) confirmBatch(count int, dirs []string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fmt.Fprintf(consoleOut, "About to process %d files under %s — continue? [y/N]: ", count, strings.Join(dirs, ", "))
+	line, _ := p.in.ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// isTerminal reports whether f is attached to a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
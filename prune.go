@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sidecarSuffixes are the file endings of the nfo and artwork written next
+// to a video in the dialect of cfg. Only these are ever reported as orphans.
+func sidecarSuffixes(cfg Config) []string {
+	poster, fanart := nfoWriterFor(cfg).ArtworkPaths("")
+	return []string{".nfo", poster, fanart, trailerSuffix}
+}
+
+// isBareSuffix reports whether suffix is just an extension, like emby's
+// ".jpg" poster, which any image has
+func isBareSuffix(suffix string) bool {
+	return suffix != ".nfo" && suffix == filepath.Ext(suffix)
+}
+
+// findOrphans walks root for nfo and artwork files whose video, matched by
+// base name in the same directory, is gone. Files only matching a bare
+// suffix are counted when another sidecar of the same base is there too, so
+// a stray photo.jpg isn't taken for an emby poster. The sample and actor
+// folders hold images, not sidecars, and are skipped.
+func findOrphans(ctx context.Context, root string, cfg Config) ([]string, error) {
+	var named, bare []string
+	for _, suffix := range sidecarSuffixes(cfg) {
+		if isBareSuffix(suffix) {
+			bare = append(bare, suffix)
+		} else {
+			named = append(named, suffix)
+		}
+	}
+	videos := make(map[string]bool)
+	bases := make(map[string]bool)
+	var sidecars, bareSidecars []string
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			slog.Warn("Error reading, skipped", "path", path, "err", err)
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if path != root && isExcluded(path, d.IsDir(), cfg.ExcludePatterns) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if path != root && (d.Name() == sampleDir || d.Name() == actorDir) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// Trailers end in a video extension, sidecars are checked first
+		for _, suffix := range named {
+			if base, ok := strings.CutSuffix(path, suffix); ok {
+				sidecars = append(sidecars, path)
+				bases[base] = true
+				return nil
+			}
+		}
+		for _, suffix := range bare {
+			if strings.HasSuffix(path, suffix) {
+				bareSidecars = append(bareSidecars, path)
+				return nil
+			}
+		}
+		if isVideoFile(path, cfg.VideoTypes) {
+			videos[strings.TrimSuffix(path, filepath.Ext(path))] = true
+		}
+		return nil
+	})
+
+	var orphans []string
+	for _, path := range sidecars {
+		if !hasVideo(path, named, videos) {
+			orphans = append(orphans, path)
+		}
+	}
+	for _, path := range bareSidecars {
+		base := strings.TrimSuffix(path, filepath.Ext(path))
+		if bases[base] && !videos[base] {
+			orphans = append(orphans, path)
+		}
+	}
+	return orphans, err
+}
+
+// hasVideo reports whether the sidecar at path belongs to one of videos.
+// Every suffix that matches is tried.
+func hasVideo(path string, suffixes []string, videos map[string]bool) bool {
+	for _, suffix := range suffixes {
+		if base, ok := strings.CutSuffix(path, suffix); ok && videos[base] {
+			return true
+		}
+	}
+	return false
+}
+
+// pruneOrphans lists the orphaned sidecars under the source directories and
+// deletes them when remove is set. It returns how many it found and how many
+// couldn't be deleted.
+func pruneOrphans(ctx context.Context, cfg Config, remove bool) (found, failed int, err error) {
+	for _, dir := range sourceDirs(cfg) {
+		orphans, err := findOrphans(ctx, dir, cfg)
+		if err != nil {
+			return found, failed, err
+		}
+		sortPaths(orphans)
+		for _, path := range orphans {
+			found++
+			if !remove || cfg.DryRun {
+				slog.Info("Orphaned", "file", path)
+				continue
+			}
+			if err := os.Remove(path); err != nil {
+				slog.Error("Error removing orphan", "file", path, "err", err)
+				failed++
+				continue
+			}
+			slog.Info("Removed orphan", "file", path)
+		}
+	}
+	return found, failed, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// noMatch is printed by -report for files without a code
+const noMatch = "NO MATCH"
+
+// writeReport prints the code found in every file, or noMatch, followed by
+// how many files each rule matched. Nothing is renamed.
+func writeReport(w io.Writer, files []string, cfg Config) (matched int) {
+	counts := make(map[string]int)
+	var unmatched []string
+	for _, file := range files {
+		code, rule := matchFileCode(file, cfg)
+		if code == "" {
+			unmatched = append(unmatched, file)
+			fmt.Fprintf(w, "%-16s %s\n", noMatch, file)
+			continue
+		}
+		matched++
+		counts[rule]++
+		fmt.Fprintf(w, "%-16s %s\n", code, file)
+	}
+
+	rules := make([]string, 0, len(counts))
+	for rule := range counts {
+		rules = append(rules, rule)
+	}
+	slices.SortFunc(rules, func(a, b string) int {
+		return cmp.Or(cmp.Compare(counts[b], counts[a]), cmp.Compare(a, b))
+	})
+
+	fmt.Fprintf(w, "\nMatched %d of %d files\n", matched, len(files))
+	for _, rule := range rules {
+		fmt.Fprintf(w, "%6d  %s\n", counts[rule], rule)
+	}
+	if len(unmatched) > 0 {
+		fmt.Fprintf(w, "%6d  %s\n", len(unmatched), "no match:")
+		for _, file := range unmatched {
+			fmt.Fprintf(w, "        %s\n", file)
+		}
+	}
+	return matched
+}
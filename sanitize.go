@@ -0,0 +1,78 @@
+package main
+
+import (
+	"runtime"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxNameBytes is the longest file name most filesystems accept
+const maxNameBytes = 255
+
+// windowsMaxName is the name length in bytes used on Windows, where the 260
+// character MAX_PATH limit covers the whole path and not just one name
+const windowsMaxName = 120
+
+// windowsReservedNames are device names Windows won't use as file names,
+// with or without an extension
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// windowsIllegalChars can't appear in file names on Windows, next to the
+// control characters
+const windowsIllegalChars = `<>:"/\|?*`
+
+// sanitizePath makes a generated name, such as one built from a scraped
+// title, safe to use as a single path component. The path separator and NUL
+// are replaced and leading/trailing dots and spaces trimmed everywhere; on
+// Windows its illegal characters are replaced too, reserved device names
+// avoided and names kept short. ext is appended after truncation so it is
+// never cut off. Empty names become "Unknown".
+func sanitizePath(name, ext string) string {
+	windows := runtime.GOOS == "windows"
+	name = strings.Map(func(r rune) rune {
+		if r == '/' || r == 0 || (windows && (r < 0x20 || strings.ContainsRune(windowsIllegalChars, r))) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, " .")
+	if name == "" {
+		name = "Unknown"
+	}
+
+	limit := maxNameBytes - len(ext)
+	if windows {
+		stem, _, _ := strings.Cut(name, ".")
+		if windowsReservedNames[strings.ToUpper(strings.TrimSpace(stem))] {
+			name = "_" + name
+		}
+		limit = min(limit, windowsMaxName-len(ext))
+	}
+	return truncateName(name, limit) + ext
+}
+
+// truncateName cuts name to at most limit bytes on a rune boundary and
+// trims the dots and spaces that leaves at the end
+func truncateName(name string, limit int) string {
+	if len(name) <= limit {
+		return name
+	}
+	if limit <= 0 {
+		return "_"
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(name[cut]) {
+		cut--
+	}
+	name = strings.TrimRight(name[:cut], " .")
+	if name == "" {
+		return "_"
+	}
+	return name
+}
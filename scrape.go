@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// MovieInfo holds the metadata scraped for a movie code
+type MovieInfo struct {
+	Code        string
+	Title       string
+	ReleaseDate string
+	Studio      string
+	Actors      []string
+	Genres      []string
+	CoverURL    string
+	PosterURL   string
+	// SampleImages are the preview screenshots of the movie
+	SampleImages []string
+	// TrailerURL is the preview video, when the page embeds one
+	TrailerURL string
+	// ActorThumbs maps actor names to their headshot, when the source has one
+	ActorThumbs map[string]string
+	// Subtitled is set from the file name's -C/-UC marker, not scraped
+	Subtitled bool
+	// Set is the collection from Config.SeriesMap, not scraped either
+	Set string
+	// Source is the name of the scraper the metadata came from and SourceID
+	// the movie's id on that site, when it has one
+	Source   string
+	SourceID string
+}
+
+// Scraper fetches movie metadata from one source site. Fetch gets the shared
+// client, which already carries the rate limit, retries and cookies. Name is
+// the scraper's key in scrapers and Describe is shown by -list-sources.
+type Scraper interface {
+	Fetch(ctx context.Context, client *http.Client, code string) (MovieInfo, error)
+	Name() string
+	Describe() sourceInfo
+}
+
+// sourceInfo describes a scraper for -list-sources
+type sourceInfo struct {
+	Site  string // URL of the site, empty for none
+	Codes string // the code formats the site has
+	Auth  string // what it takes to get in, empty for nothing
+}
+
+// scrapers maps the names usable in Config.Sources to their constructors
+var scrapers = map[string]func() Scraper{
+	"javbus":      func() Scraper { return &javbusScraper{baseURL: javbusBaseURL} },
+	"javlibrary":  func() Scraper { return &javlibraryScraper{searchURL: javlibrarySearchURL} },
+	offlineSource: func() Scraper { return offlineScraper{} },
+}
+
+// defaultSources is used when the config doesn't list any sources
+var defaultSources = []string{"javbus"}
+
+// writeSourceList prints every registered scraper, in name order, with its
+// description
+func writeSourceList(w io.Writer) {
+	for _, name := range slices.Sorted(maps.Keys(scrapers)) {
+		s := scrapers[name]()
+		title := s.Name()
+		if slices.Contains(defaultSources, title) {
+			title += " (default)"
+		}
+		info := s.Describe()
+		auth := info.Auth
+		if auth == "" {
+			auth = "none"
+		}
+		fmt.Fprintln(w, title)
+		if info.Site != "" {
+			fmt.Fprintf(w, "    site:  %s\n", info.Site)
+		}
+		fmt.Fprintf(w, "    codes: %s\n", info.Codes)
+		fmt.Fprintf(w, "    auth:  %s\n", auth)
+	}
+}
+
+// errNotFound is returned by scrapers when the source doesn't have the code
+var errNotFound = errors.New("not found")
+
+// scrapeSources returns the configured source names in fallback order
+func scrapeSources(cfg Config) []string {
+	if len(cfg.Sources) == 0 {
+		return defaultSources
+	}
+	return cfg.Sources
+}
+
+// scrapeMovie tries each configured source in order until one returns
+// metadata for code. Cached results are used unless cfg.Force is set.
+func scrapeMovie(ctx context.Context, f *fetcher, code string, cfg Config) (MovieInfo, error) {
+	if f.cache != nil && !cfg.Force {
+		info, ok, err := f.cache.get(code)
+		if err != nil {
+			slog.Warn("Error reading metadata cache", "code", code, "err", err)
+		} else if ok {
+			slog.Debug("Using cached metadata", "code", code)
+			return info, nil
+		}
+	}
+
+	info, err := fetchFromSources(ctx, f, code, cfg)
+	if err != nil {
+		return MovieInfo{}, err
+	}
+	// The offline placeholder mustn't hide the real metadata later
+	if f.cache != nil && info.Source != offlineSource {
+		if err := f.cache.put(code, info); err != nil {
+			slog.Warn("Error writing metadata cache", "code", code, "err", err)
+		}
+	}
+	return info, nil
+}
+
+// enrichInfo applies the local tables of cfg to info scraped for code: the
+// series and, when the source has none, the studio by code prefix, the
+// genre translations and the canonical actor names
+func enrichInfo(info MovieInfo, code string, cfg Config) MovieInfo {
+	info.Set = seriesName(code, cfg.SeriesMap)
+	if info.Studio == "" {
+		info.Studio = studioName(code, cfg.StudioMap)
+	}
+	info.Genres = translateGenres(info.Genres, cfg.GenreMap)
+	return canonicalActors(info, cfg.ActorAliases)
+}
+
+// fetchFromSources runs the source fallback chain for code
+func fetchFromSources(ctx context.Context, f *fetcher, code string, cfg Config) (MovieInfo, error) {
+	var failures []string
+	for _, name := range scrapeSources(cfg) {
+		newScraper, ok := scrapers[name]
+		if !ok {
+			// Unknown sources are reported by validateConfig
+			continue
+		}
+		info, err := newScraper().Fetch(ctx, f.client, code)
+		if err == nil && info.Title == "" {
+			err = errNotFound
+		}
+		if errors.Is(err, errBlocked) {
+			slog.Warn("Blocked by source, lower requests_per_second or add proxies to proxy_list", "source", name, "code", code)
+		}
+		if err != nil {
+			slog.Debug("Source failed", "source", name, "code", code, "err", err)
+			failures = append(failures, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		info.Source = name
+		return info, nil
+	}
+	return MovieInfo{}, fmt.Errorf("no source had code %s (%s)", code, strings.Join(failures, "; "))
+}
+
+// fetchDocument downloads and parses the HTML page at pageURL, returning the
+// final URL after redirects for resolving relative links
+func fetchDocument(ctx context.Context, client *http.Client, pageURL string) (*goquery.Document, *url.URL, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", pageURL, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating request: %v", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		// Wrapped so fetchFromSources can tell blocks from other failures
+		return nil, nil, fmt.Errorf("error fetching %s: %w", pageURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil, errNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("unexpected status fetching %s: %s", pageURL, resp.Status)
+	}
+
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing page: %v", err)
+	}
+	return doc, resp.Request.URL, nil
+}
+
+// resolveURL turns a possibly relative href into an absolute URL
+func resolveURL(base *url.URL, href string) string {
+	ref, err := url.Parse(href)
+	if err != nil {
+		return href
+	}
+	return base.ResolveReference(ref).String()
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// serveFixture writes the testdata page name to w
+func serveFixture(t *testing.T, w http.ResponseWriter, name string) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Error(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(data)
+}
+
+func TestJavbusScraper(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ABC-123", "/XYZ-001":
+			serveFixture(t, w, "javbus_"+r.URL.Path[1:]+".html")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	s := &javbusScraper{baseURL: srv.URL + "/"}
+
+	tests := []struct {
+		code string
+		want MovieInfo
+	}{
+		{"ABC-123", MovieInfo{
+			Code:         "ABC-123",
+			Title:        "Sample Title",
+			ReleaseDate:  "2020-01-02",
+			Studio:       "Sample Studio",
+			Actors:       []string{"Actor One", "Actor Two"},
+			Genres:       []string{"Drama", "Romance"},
+			CoverURL:     srv.URL + "/pics/cover/abcd_b.jpg",
+			PosterURL:    srv.URL + "/pics/thumb/abcd.jpg",
+			SampleImages: []string{srv.URL + "/pics/sample/abcd_1.jpg", "https://pics.example.com/abcd_2.jpg"},
+			TrailerURL:   srv.URL + "/trailers/abc123.mp4",
+			ActorThumbs:  map[string]string{"Actor One": srv.URL + "/pics/actress/one_a.jpg"},
+			SourceID:     "ABC-123",
+		}},
+		// Only a title and a cover outside /pics/cover/, which is the poster too
+		{"XYZ-001", MovieInfo{
+			Code:      "XYZ-001",
+			Title:     "Partial",
+			CoverURL:  "https://img.example.com/covers/xyz001.jpg",
+			PosterURL: "https://img.example.com/covers/xyz001.jpg",
+			SourceID:  "XYZ-001",
+		}},
+	}
+	for _, tt := range tests {
+		got, err := s.Fetch(context.Background(), srv.Client(), tt.code)
+		if err != nil {
+			t.Errorf("Fetch(%q): %v", tt.code, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Fetch(%q) = %+v, want %+v", tt.code, got, tt.want)
+		}
+	}
+
+	if _, err := s.Fetch(context.Background(), srv.Client(), "ZZZ-999"); !errors.Is(err, errNotFound) {
+		t.Errorf("Fetch of a missing page: err = %v, want errNotFound", err)
+	}
+}
+
+func TestJavlibraryScraper(t *testing.T) {
+	// Exact matches redirect to the ?v=<id> detail page, anything else gets
+	// the search result list
+	ids := map[string]string{"ABC-123": "javli123", "XYZ-001": "javli456"}
+	pages := map[string]string{"javli123": "javlibrary_ABC-123.html", "javli456": "javlibrary_XYZ-001.html"}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/search":
+			if id, ok := ids[r.URL.Query().Get("keyword")]; ok {
+				http.Redirect(w, r, "/cn/?v="+id, http.StatusFound)
+				return
+			}
+			serveFixture(t, w, "javlibrary_search.html")
+		case "/cn/":
+			if page, ok := pages[r.URL.Query().Get("v")]; ok {
+				serveFixture(t, w, page)
+				return
+			}
+			http.NotFound(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	s := &javlibraryScraper{searchURL: srv.URL + "/search?keyword="}
+
+	tests := []struct {
+		code string
+		want MovieInfo
+	}{
+		{"ABC-123", MovieInfo{
+			Code:         "ABC-123",
+			Title:        "Sample Title",
+			ReleaseDate:  "2020-01-02",
+			Studio:       "Sample Studio",
+			Actors:       []string{"Actor One", "Actor Two"},
+			Genres:       []string{"Drama", "Romance"},
+			CoverURL:     "http://pics.example.com/mono/abc123pl.jpg",
+			PosterURL:    "http://pics.example.com/mono/abc123pl.jpg",
+			SampleImages: []string{"https://pics.example.com/digital/abc123jp-1.jpg", srv.URL + "/pics/abc123jp-2.jpg"},
+			SourceID:     "javli123",
+		}},
+		{"XYZ-001", MovieInfo{
+			Code:     "XYZ-001",
+			Title:    "Partial",
+			SourceID: "javli456",
+		}},
+	}
+	for _, tt := range tests {
+		got, err := s.Fetch(context.Background(), srv.Client(), tt.code)
+		if err != nil {
+			t.Errorf("Fetch(%q): %v", tt.code, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Fetch(%q) = %+v, want %+v", tt.code, got, tt.want)
+		}
+	}
+
+	if _, err := s.Fetch(context.Background(), srv.Client(), "ZZZ-999"); !errors.Is(err, errNotFound) {
+		t.Errorf("Fetch without an exact match: err = %v, want errNotFound", err)
+	}
+}
+
+func TestFetchDocumentStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "blocked", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	_, _, err := fetchDocument(context.Background(), srv.Client(), srv.URL+"/ABC-123")
+	if err == nil || errors.Is(err, errNotFound) {
+		t.Errorf("fetchDocument on 403: err = %v, want a status error", err)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// scrapeIgnoreFile lists, in gitignore syntax, files and folders below its
+// directory the walk leaves out
+const scrapeIgnoreFile = ".scrapeignore"
+
+// ignoreRule is one line of a .scrapeignore file
+type ignoreRule struct {
+	// segments are the globs of the pattern's path segments, "**" matching
+	// any number of segments
+	segments []string
+	// anchored rules contain a slash and match the path below the file's
+	// directory, the others match the base name at any depth
+	anchored bool
+	dirOnly  bool
+	negate   bool
+}
+
+// ignoreList holds the rules of the .scrapeignore file in dir
+type ignoreList struct {
+	dir   string
+	rules []ignoreRule
+}
+
+// parseIgnoreRules parses the lines of a .scrapeignore file. Blank lines and
+// # comments are skipped, as are invalid globs. Patterns are lowercased,
+// matching is case-insensitive like ExcludePatterns.
+func parseIgnoreRules(data string) []ignoreRule {
+	var rules []ignoreRule
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var rule ignoreRule
+		if pattern, ok := strings.CutPrefix(line, "!"); ok {
+			rule.negate, line = true, pattern
+		}
+		// \# and \! stand for a literal first character
+		line = strings.TrimPrefix(line, `\`)
+		if pattern, ok := strings.CutSuffix(line, "/"); ok {
+			rule.dirOnly, line = true, pattern
+		}
+		if pattern, ok := strings.CutPrefix(line, "/"); ok {
+			rule.anchored, line = true, pattern
+		}
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+		}
+		if line == "" {
+			continue
+		}
+
+		rule.segments = strings.Split(strings.ToLower(line), "/")
+		valid := true
+		for _, segment := range rule.segments {
+			if _, err := path.Match(segment, ""); err != nil {
+				valid = false
+			}
+		}
+		if valid {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// match reports whether rel, slash-separated below l.dir, is ignored by the
+// list's last matching rule, and whether any rule matched at all
+func (l ignoreList) match(rel string, isDir bool) (ignored, matched bool) {
+	parts := strings.Split(strings.ToLower(rel), "/")
+	for _, rule := range l.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		ok := false
+		if rule.anchored {
+			ok = matchSegments(rule.segments, parts)
+		} else {
+			ok, _ = path.Match(rule.segments[0], parts[len(parts)-1])
+		}
+		if ok {
+			ignored, matched = !rule.negate, true
+		}
+	}
+	return ignored, matched
+}
+
+// matchSegments matches path segments against pattern segments, "**"
+// standing for zero or more of them
+func matchSegments(pattern, parts []string) bool {
+	if len(pattern) == 0 {
+		return len(parts) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(parts); i++ {
+			if matchSegments(pattern[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	ok, _ := path.Match(pattern[0], parts[0])
+	return ok && matchSegments(pattern[1:], parts[1:])
+}
+
+// scrapeIgnorer keeps the .scrapeignore files of the directories a walk is
+// currently in, outermost first
+type scrapeIgnorer struct {
+	lists []ignoreList
+}
+
+// enter loads the .scrapeignore file of dir, if it has one. The walk calls
+// it for every directory before visiting its entries.
+func (s *scrapeIgnorer) enter(dir string) {
+	s.leave(dir)
+	data, err := os.ReadFile(filepath.Join(dir, scrapeIgnoreFile))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("Error reading "+scrapeIgnoreFile, "dir", dir, "err", err)
+		}
+		return
+	}
+	if rules := parseIgnoreRules(string(data)); len(rules) > 0 {
+		s.lists = append(s.lists, ignoreList{dir: dir, rules: rules})
+	}
+}
+
+// leave drops the lists of directories the walk has left for p
+func (s *scrapeIgnorer) leave(p string) {
+	for len(s.lists) > 0 {
+		// Rel rather than a prefix check, below a root of "." the walk's
+		// paths have no "./" in front
+		rel, err := filepath.Rel(s.lists[len(s.lists)-1].dir, p)
+		if err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return
+		}
+		s.lists = s.lists[:len(s.lists)-1]
+	}
+}
+
+// ignored reports whether p is left out by the .scrapeignore files above
+// it. Like git, a deeper file overrides the ones above it.
+func (s *scrapeIgnorer) ignored(p string, isDir bool) bool {
+	s.leave(p)
+	ignored := false
+	for _, list := range s.lists {
+		rel, err := filepath.Rel(list.dir, p)
+		if err != nil {
+			continue
+		}
+		if ok, matched := list.match(filepath.ToSlash(rel), isDir); matched {
+			ignored = ok
+		}
+	}
+	return ignored
+}
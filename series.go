@@ -0,0 +1,28 @@
+package main
+
+import "strings"
+
+// seriesName returns the collection code belongs to according to seriesMap
+func seriesName(code string, seriesMap map[string]string) string {
+	return prefixValue(code, seriesMap)
+}
+
+// studioName returns the studio that releases code according to studioMap
+func studioName(code string, studioMap map[string]string) string {
+	return prefixValue(code, studioMap)
+}
+
+// prefixValue looks code up in table, whose keys are code prefixes compared
+// case-insensitively. The longest matching prefix wins, so "ABW-1" can
+// override "ABW". No match gives "".
+func prefixValue(code string, table map[string]string) string {
+	code = strings.ToUpper(code)
+	var value string
+	longest := 0
+	for prefix, v := range table {
+		if len(prefix) > longest && strings.HasPrefix(code, strings.ToUpper(prefix)) {
+			value, longest = v, len(prefix)
+		}
+	}
+	return value
+}
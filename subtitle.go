@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultSubtitleTypes is used when the config doesn't set SubtitleTypes
+var defaultSubtitleTypes = []string{".srt", ".ass", ".ssa", ".vtt", ".sub"}
+
+// renameSubtitles renames the subtitles sharing the video's old base name so
+// they follow it to newPath. A language part such as oldname.zh.srt is kept:
+// it becomes ABC-123.zh.srt.
+func renameSubtitles(ctx context.Context, oldPath, newPath string, cfg Config) {
+	subtitleTypes := cfg.SubtitleTypes
+	if len(subtitleTypes) == 0 {
+		subtitleTypes = defaultSubtitleTypes
+	}
+
+	dir := filepath.Dir(oldPath)
+	oldBase := strings.TrimSuffix(filepath.Base(oldPath), filepath.Ext(oldPath))
+	newBase := strings.TrimSuffix(newPath, filepath.Ext(newPath))
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		slog.Warn("Error reading subtitles", "dir", dir, "err", err)
+		return
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, oldBase+".") {
+			continue
+		}
+		if !isVideoFile(name, subtitleTypes) {
+			continue
+		}
+		ext := filepath.Ext(name)
+		// Whatever sits between the base name and the extension, e.g. ".zh"
+		lang := name[len(oldBase) : len(name)-len(ext)]
+
+		subPath := filepath.Join(dir, name)
+		renameMu.Lock()
+		target := getUniqueFilePath(ctx, subPath, newBase+lang+ext, cfg)
+		if target == subPath || alreadyTransferred(ctx, subPath, target, cfg) {
+			renameMu.Unlock()
+			continue
+		}
+		if cfg.DryRun {
+			renameMu.Unlock()
+		} else {
+			reservePath(target)
+			renameMu.Unlock()
+			err := transferFile(ctx, subPath, target, cfg)
+			releasePath(target)
+			if err != nil {
+				slog.Error("Error renaming subtitle", "file", subPath, "to", target, "err", err)
+				continue
+			}
+			recordUndo(subPath, target, cfg)
+		}
+		slog.Info("Renamed subtitle", "file", subPath, "to", filepath.Base(target))
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// containerTagTypes are the containers writeContainerTags knows how to tag
+var containerTagTypes = []string{".mp4", ".m4v"}
+
+// writeContainerTags stores the title, date, genres and a comment in the
+// mp4 container of path with ffmpeg. The streams are copied untouched into
+// a temp file that replaces path only once ffmpeg has succeeded.
+func writeContainerTags(ctx context.Context, path string, info MovieInfo, cfg Config) error {
+	if !isVideoFile(path, containerTagTypes) {
+		return nil
+	}
+	// Rewriting a symlink would turn it into a full copy, and a hardlink
+	// would be split off from the other names of the file
+	if linkMode(cfg) == "hardlink" {
+		return nil
+	}
+	if fi, err := os.Lstat(path); err != nil || fi.Mode()&os.ModeSymlink != 0 || linkCount(fi) > 1 {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating temp file: %v", err)
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+
+	comment := info.Code
+	if len(info.Actors) > 0 {
+		comment += " / " + strings.Join(info.Actors, ", ")
+	}
+	args := []string{
+		"-v", "error",
+		"-i", path,
+		"-map", "0",
+		"-c", "copy",
+		"-metadata", "title=" + info.Code + " " + info.Title,
+		"-metadata", "date=" + info.ReleaseDate,
+		"-metadata", "genre=" + strings.Join(info.Genres, ", "),
+		"-metadata", "comment=" + comment,
+		"-f", "mp4",
+		"-y", tmpPath,
+	}
+	if out, err := exec.CommandContext(ctx, ffmpegBinary(cfg), args...).CombinedOutput(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("error running ffmpeg on %s: %v: %s", path, err, strings.TrimSpace(string(out)))
+	}
+
+	if fi, err := os.Stat(path); err == nil {
+		os.Chmod(tmpPath, fi.Mode().Perm())
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("error replacing %s: %v", path, err)
+	}
+	return nil
+}
+
+// ffmpegBinary returns the configured ffmpeg, defaulting to the one on PATH
+func ffmpegBinary(cfg Config) string {
+	if cfg.FFmpegPath == "" {
+		return "ffmpeg"
+	}
+	return cfg.FFmpegPath
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// trailerSuffix is appended to the video's base name for the trailer file,
+// the name Jellyfin and Kodi look for
+const trailerSuffix = "-trailer.mp4"
+
+// isTrailer reports whether path is a trailer, a video whose base name ends
+// in -trailer like the ones downloadTrailer saves. The walk and the watcher
+// always leave them out, whatever ExcludePatterns says.
+func isTrailer(path string) bool {
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return strings.HasSuffix(strings.ToLower(base), strings.TrimSuffix(trailerSuffix, filepath.Ext(trailerSuffix)))
+}
+
+// trailerTypes are the content types accepted for trailers
+var trailerTypes = []string{"video/mp4"}
+
+// downloadTrailer saves the trailer of info as <basePath>-trailer.mp4,
+// unless there is no trailer or the file is already there
+func downloadTrailer(ctx context.Context, f *fetcher, info MovieInfo, basePath string) error {
+	if info.TrailerURL == "" {
+		return nil
+	}
+	path := basePath + trailerSuffix
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	return downloadFile(ctx, f, info.TrailerURL, path, trailerTypes)
+}
+
+// findTrailer returns the URL of the preview video embedded in a detail
+// page, or "" if it has none
+func findTrailer(doc *goquery.Document, pageURL *url.URL) string {
+	if src, ok := doc.Find("video source[src]").First().Attr("src"); ok {
+		return resolveURL(pageURL, src)
+	}
+	if src, ok := doc.Find("video[src]").First().Attr("src"); ok {
+		return resolveURL(pageURL, src)
+	}
+	return ""
+}
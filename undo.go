@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// undoLogFile records every rename so a run can be rolled back with -undo
+const undoLogFile = "undo.log"
+
+// undoRunPrefix starts the marker line in front of the entries of each run
+const undoRunPrefix = "# run "
+
+// undoRunID names the entries this process writes to the undo log
+var undoRunID = fmt.Sprintf("%s-%d", time.Now().Format("20060102-150405"), os.Getpid())
+
+// undoMu guards undoMarked
+var undoMu sync.Mutex
+
+// undoMarked holds the undo logs this run has written its marker to
+var undoMarked = make(map[string]bool)
+
+// appendUndoEntry appends an "old\tnew" line to the undo log, after the
+// marker of the current run when it is the run's first. Each entry is
+// written with a single write and synced, so an interrupted run still leaves
+// a usable log behind.
+func appendUndoEntry(logPath, oldPath, newPath string) error {
+	oldAbs, err := filepath.Abs(oldPath)
+	if err != nil {
+		return fmt.Errorf("error resolving %s: %v", oldPath, err)
+	}
+	newAbs, err := filepath.Abs(newPath)
+	if err != nil {
+		return fmt.Errorf("error resolving %s: %v", newPath, err)
+	}
+
+	f, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening undo log: %v", err)
+	}
+	defer f.Close()
+
+	line := oldAbs + "\t" + newAbs + "\n"
+	undoMu.Lock()
+	if !undoMarked[logPath] {
+		line = undoRunPrefix + undoRunID + "\n" + line
+		undoMarked[logPath] = true
+	}
+	_, err = f.WriteString(line)
+	undoMu.Unlock()
+	if err != nil {
+		return fmt.Errorf("error writing undo log: %v", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("error syncing undo log: %v", err)
+	}
+	return nil
+}
+
+// undoRun is one run's entries in the undo log. Entries written before runs
+// had markers make up a run without id.
+type undoRun struct {
+	id      string
+	entries [][2]string
+}
+
+// readUndoLog returns the runs in the undo log at logPath, oldest first
+func readUndoLog(logPath string) ([]undoRun, error) {
+	f, err := os.Open(logPath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening undo log: %v", err)
+	}
+	defer f.Close()
+
+	var runs []undoRun
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if id, ok := strings.CutPrefix(scanner.Text(), undoRunPrefix); ok {
+			runs = append(runs, undoRun{id: id})
+			continue
+		}
+		oldPath, newPath, ok := strings.Cut(scanner.Text(), "\t")
+		if !ok {
+			continue
+		}
+		if len(runs) == 0 {
+			runs = append(runs, undoRun{})
+		}
+		runs[len(runs)-1].entries = append(runs[len(runs)-1].entries, [2]string{oldPath, newPath})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading undo log: %v", err)
+	}
+	return runs, nil
+}
+
+// writeUndoLog replaces the undo log at logPath with runs, dropping the ones
+// without entries left
+func writeUndoLog(logPath string, runs []undoRun) error {
+	var b strings.Builder
+	for _, run := range runs {
+		if len(run.entries) == 0 {
+			continue
+		}
+		if run.id != "" {
+			b.WriteString(undoRunPrefix + run.id + "\n")
+		}
+		for _, entry := range run.entries {
+			b.WriteString(entry[0] + "\t" + entry[1] + "\n")
+		}
+	}
+	tmp := logPath + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("error writing undo log: %v", err)
+	}
+	if err := os.Rename(tmp, logPath); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error replacing undo log: %v", err)
+	}
+	return nil
+}
+
+// runUndo renames the entries of one run in the undo log back, newest
+// first: the run named id, or the last one when id is empty. Restored
+// entries are removed from the log, so the next -undo goes a run further back.
+func runUndo(logPath, id string) error {
+	runs, err := readUndoLog(logPath)
+	if err != nil {
+		return err
+	}
+	if len(runs) == 0 {
+		slog.Info("Nothing to undo", "log", logPath)
+		return nil
+	}
+	index := len(runs) - 1
+	if id != "" {
+		index = -1
+		var ids []string
+		for i, run := range runs {
+			if run.id == id {
+				index = i
+			}
+			ids = append(ids, run.id)
+		}
+		if index < 0 {
+			return fmt.Errorf("no run %q in undo log, it has %s", id, strings.Join(ids, ", "))
+		}
+	}
+	run := &runs[index]
+	slog.Info("Undoing run", "run", run.id, "entries", len(run.entries))
+
+	restored := 0
+	var kept [][2]string
+	for i := len(run.entries) - 1; i >= 0; i-- {
+		oldPath, newPath := run.entries[i][0], run.entries[i][1]
+		if _, err := os.Stat(newPath); err != nil {
+			slog.Info("Skipped (no longer exists)", "file", newPath)
+			continue
+		}
+		if _, err := os.Stat(oldPath); err == nil {
+			slog.Info("Skipped (original path already exists)", "file", newPath, "to", oldPath)
+			kept = append(kept, run.entries[i])
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(oldPath), 0755); err != nil {
+			slog.Error("Error creating folder", "file", oldPath, "err", err)
+			kept = append(kept, run.entries[i])
+			continue
+		}
+		if err := moveFile(context.Background(), newPath, oldPath); err != nil {
+			slog.Error("Error restoring", "file", newPath, "to", oldPath, "err", err)
+			kept = append(kept, run.entries[i])
+			continue
+		}
+		restored++
+		slog.Info("Restored", "file", newPath, "to", oldPath)
+	}
+
+	slog.Info(fmt.Sprintf("Restored %d of %d files", restored, len(run.entries)))
+	// kept is newest first, the log is oldest first
+	slices.Reverse(kept)
+	run.entries = kept
+	return writeUndoLog(logPath, runs)
+}
@@ -0,0 +1,38 @@
+package main
+
+import "runtime/debug"
+
+// Build information, set at build time with
+//
+//	go build -ldflags "-X main.version=v1.2.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%Y-%m-%d)"
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// versionString returns the version with the commit and build date. Without
+// ldflags the commit comes from the VCS info Go embeds, when there is any.
+func versionString() string {
+	rev, date := commit, buildDate
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && rev == "":
+				rev = setting.Value[:min(len(setting.Value), 7)]
+			case setting.Key == "vcs.time" && date == "":
+				date = setting.Value
+			}
+		}
+	}
+
+	s := version
+	if rev != "" {
+		s += " (" + rev
+		if date != "" {
+			s += ", " + date
+		}
+		s += ")"
+	}
+	return s
+}
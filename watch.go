@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchStableInterval is how long a new file's size must stay unchanged
+// before it is considered fully written
+const watchStableInterval = 2 * time.Second
+
+// watchDirs watches the source directories recursively and runs
+// processFile on every video file that is created or moved in, until ctx
+// is cancelled. Events go through the same filters as findVideoFiles, and
+// up to Concurrency files are processed at a time, one in interactive
+// mode. onResult, when not nil, is called with every processed file.
+func watchDirs(ctx context.Context, cfg Config, f *fetcher, onResult func(fileResult)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("error creating watcher: %v", err)
+	}
+	defer watcher.Close()
+
+	roots := sourceDirs(cfg)
+	for _, dir := range roots {
+		if err := addWatchRecursive(watcher, dir, dir, cfg); err != nil {
+			return err
+		}
+	}
+
+	workers := cfg.Concurrency
+	if workers <= 0 {
+		workers = defaultConcurrency
+	}
+	// Prompts and their answers must not interleave
+	if cfg.Interactive {
+		workers = 1
+	}
+	slots := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	// Like processFiles, let started files finish after Ctrl-C
+	defer wg.Wait()
+	quit := make(chan struct{})
+	var quitOnce sync.Once
+
+	var mu sync.Mutex
+	// Files waiting to settle or being processed
+	pending := make(map[string]bool)
+	ready := make(chan string)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-quit:
+			return nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+
+			if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+				// Deleted directories drop out of the watch list
+				if err := watcher.Remove(event.Name); err == nil {
+					slog.Debug("Stopped watching", "path", event.Name)
+				}
+				continue
+			}
+			if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+				continue
+			}
+
+			info, err := os.Stat(event.Name)
+			if err != nil {
+				continue
+			}
+			root := watchRoot(roots, event.Name)
+			if info.IsDir() {
+				if event.Has(fsnotify.Create) {
+					if err := addWatchRecursive(watcher, root, event.Name, cfg); err != nil {
+						slog.Warn("Error watching directory", "path", event.Name, "err", err)
+					}
+				}
+				continue
+			}
+			if !isVideoFile(event.Name, cfg.VideoTypes) {
+				continue
+			}
+			if reason := skippedWatchPath(root, event.Name, cfg); reason != "" {
+				slog.Debug("Skipped ("+reason+")", "path", event.Name)
+				continue
+			}
+
+			// Files we renamed ourselves show up as new files too. Their
+			// target is recorded before the rename, see reservePath.
+			if isTransferTarget(event.Name) {
+				continue
+			}
+			mu.Lock()
+			skip := pending[event.Name]
+			pending[event.Name] = true
+			mu.Unlock()
+			if skip {
+				continue
+			}
+
+			slog.Debug("New video file", "file", event.Name)
+			go func(path string) {
+				waitUntilStable(path)
+				select {
+				case ready <- path:
+				case <-ctx.Done():
+				case <-quit:
+				}
+			}(event.Name)
+
+		case path := <-ready:
+			// Our own rename may have finished while the file settled
+			skip := isTransferTarget(path)
+			// Sizes are only final once the file has settled
+			info, err := os.Stat(path)
+			if err == nil && !skip {
+				if reason := skippedVideo(path, info, cfg); reason != "" {
+					slog.Debug("Skipped ("+reason+")", "file", path, "size", info.Size())
+					skip = true
+				}
+			}
+			if err != nil || skip {
+				mu.Lock()
+				delete(pending, path)
+				mu.Unlock()
+				continue
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				select {
+				case slots <- struct{}{}:
+				case <-ctx.Done():
+					return
+				case <-quit:
+					return
+				}
+				defer func() { <-slots }()
+				select {
+				case <-quit:
+					return
+				default:
+				}
+
+				fileCtx, cancelFile := fileContext(ctx, cfg)
+				result, err := processFile(fileCtx, path, cfg, f)
+				err = fileTimeoutErr(fileCtx, err)
+				cancelFile()
+
+				mu.Lock()
+				defer mu.Unlock()
+				delete(pending, path)
+				if errors.Is(err, errQuit) {
+					quitOnce.Do(func() { close(quit) })
+					return
+				}
+				if err != nil {
+					slog.Error("Error processing", "file", path, "err", err)
+					result.Err = err
+				}
+				// Held under mu, so results don't interleave
+				if onResult != nil {
+					onResult(result)
+				}
+			}()
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			slog.Warn("Watcher error", "err", err)
+		}
+	}
+}
+
+// watchRoot returns the source directory of roots that path lies in, the
+// deepest one when they nest
+func watchRoot(roots []string, path string) string {
+	best := ""
+	for _, root := range roots {
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if len(root) > len(best) {
+			best = root
+		}
+	}
+	if best == "" {
+		return filepath.Dir(path)
+	}
+	return best
+}
+
+// enterAncestors runs the directories from root down to dir through
+// skippedPath like the walk would, entering their .scrapeignore files. It
+// returns the ignorer for the entries of dir, and the reason when dir or one
+// above it is left out.
+func enterAncestors(root, dir string, cfg Config) (*scrapeIgnorer, string) {
+	ignorer := &scrapeIgnorer{}
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return ignorer, ""
+	}
+	path := root
+	ignorer.enter(root)
+	if rel == "." {
+		return ignorer, ""
+	}
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		path = filepath.Join(path, part)
+		if reason := skippedPath(root, path, true, cfg, ignorer); reason != "" {
+			return ignorer, reason
+		}
+		ignorer.enter(path)
+	}
+	return ignorer, ""
+}
+
+// skippedWatchPath returns why the walk of root would leave out the file at
+// path, apart from its size, or "" when it wouldn't
+func skippedWatchPath(root, path string, cfg Config) string {
+	ignorer, reason := enterAncestors(root, filepath.Dir(path), cfg)
+	if reason != "" {
+		return reason
+	}
+	return skippedPath(root, path, false, cfg, ignorer)
+}
+
+// addWatchRecursive adds dir and all of its subdirectories below the source
+// directory root to watcher, leaving out the ones the walk skips
+func addWatchRecursive(watcher *fsnotify.Watcher, root, dir string, cfg Config) error {
+	ignorer, reason := enterAncestors(root, dir, cfg)
+	if reason != "" {
+		return nil
+	}
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != dir {
+			if skippedPath(root, path, true, cfg, ignorer) != "" {
+				return filepath.SkipDir
+			}
+			ignorer.enter(path)
+		}
+		if err := watcher.Add(path); err != nil {
+			return fmt.Errorf("error watching %s: %v", path, err)
+		}
+		slog.Info("Watching", "path", path)
+		return nil
+	})
+}
+
+// waitUntilStable blocks until the size of path stops changing
+func waitUntilStable(path string) {
+	var lastSize int64 = -1
+	for {
+		info, err := os.Stat(path)
+		if err != nil {
+			return
+		}
+		if info.Size() == lastSize {
+			return
+		}
+		lastSize = info.Size()
+		time.Sleep(watchStableInterval)
+	}
+}
+
+// recentWriteWindow is how recently a file must have been modified for
+// isFileStable to wait and look again
+const recentWriteWindow = time.Minute
+
+// isFileStable reports whether path looks fully written. Files modified in
+// the last minute are stat'ed twice, watchStableInterval apart, and must not
+// have changed in between.
+func isFileStable(ctx context.Context, path string) bool {
+	before, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	if time.Since(before.ModTime()) > recentWriteWindow {
+		return true
+	}
+
+	select {
+	case <-time.After(watchStableInterval):
+	case <-ctx.Done():
+		return false
+	}
+	after, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return after.Size() == before.Size() && after.ModTime().Equal(before.ModTime())
+}